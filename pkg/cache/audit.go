@@ -0,0 +1,210 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/log"
+	"github.com/rancher/lasso/pkg/metrics"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	defaultAuditInterval = time.Hour
+	defaultAuditPageSize = 500
+	defaultAuditSettle   = 10 * time.Second
+
+	driftMissing = "missing"
+	driftExtra   = "extra"
+	driftStale   = "stale"
+)
+
+// AuditOptions configures the drift audits of the caches of a kind, see SharedCacheFactoryOptions.KindAudit.
+type AuditOptions struct {
+	// Interval between audits. Defaults to 1 hour.
+	Interval time.Duration
+	// PageSize limits the objects listed per request. Defaults to 500.
+	PageSize int64
+	// Settle is how long a difference may take to reach the cache before it is reported, objects that change
+	// while the audit lists are only cached once their watch events arrived. Defaults to 10 seconds.
+	Settle time.Duration
+	// Relist makes the cache list again if it drifted.
+	Relist bool
+}
+
+func applyDefaultAuditOptions(opts AuditOptions) AuditOptions {
+	if opts.Interval == 0 {
+		opts.Interval = defaultAuditInterval
+	}
+	if opts.PageSize == 0 {
+		opts.PageSize = defaultAuditPageSize
+	}
+	if opts.Settle == 0 {
+		opts.Settle = defaultAuditSettle
+	}
+	return opts
+}
+
+// auditor periodically compares a cache with a live list of the objects' metadata. Objects are missing if they
+// are not cached, extra if they are cached but do not exist anymore and stale if the cached object has a different
+// UID or resourceVersion.
+type auditor struct {
+	key       cacheKey
+	client    *client.Client
+	namespace string
+	tweakList TweakListOptionsFunc
+	cache     *deferredCache
+	opts      AuditOptions
+}
+
+type objectVersion struct {
+	uid             types.UID
+	resourceVersion string
+}
+
+// drift maps the keys of drifted objects to the kind of drift and the version of the cached object.
+type drift map[string]driftEntry
+
+type driftEntry struct {
+	kind   string
+	cached objectVersion
+}
+
+func (d drift) count(kind string) int {
+	var count int
+	for _, entry := range d {
+		if entry.kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+func (a *auditor) run(ctx context.Context) {
+	contextID := metrics.ContextID(ctx)
+	defer metrics.DelCacheDrift(contextID, a.key.gvk)
+
+	ticker := time.NewTicker(a.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !a.cache.HasSynced() {
+			continue
+		}
+
+		d, err := a.audit(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("Failed to audit the cache of %s: %v", a.key, err)
+			}
+			continue
+		}
+
+		for _, kind := range []string{driftMissing, driftExtra, driftStale} {
+			metrics.SetCacheDrift(contextID, a.key.gvk, kind, d.count(kind))
+		}
+		if len(d) == 0 {
+			log.Debugf("The cache of %s matches the apiserver", a.key)
+			continue
+		}
+
+		log.Infof("The cache of %s drifted from the apiserver: %d missing, %d extra and %d stale objects",
+			a.key, d.count(driftMissing), d.count(driftExtra), d.count(driftStale))
+		if a.opts.Relist {
+			a.cache.deferredListWatcher.relist()
+		}
+	}
+}
+
+// audit lists the objects and returns the differences that did not settle.
+func (a *auditor) audit(ctx context.Context) (drift, error) {
+	live, err := a.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	d := a.compare(live)
+	if len(d) == 0 {
+		return d, nil
+	}
+
+	timer := time.NewTimer(a.opts.Settle)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+	}
+
+	// differences the watch caught up with in the meantime are not drift
+	settled := a.compare(live)
+	for key, entry := range d {
+		if current, ok := settled[key]; !ok || current != entry {
+			delete(d, key)
+		}
+	}
+	return d, nil
+}
+
+// list pages through the metadata of the live objects.
+func (a *auditor) list(ctx context.Context) (map[string]objectVersion, error) {
+	live := map[string]objectVersion{}
+	options := metav1.ListOptions{Limit: a.opts.PageSize}
+	if a.tweakList != nil {
+		a.tweakList(&options)
+	}
+	for {
+		list := &metav1.PartialObjectMetadataList{}
+		if err := a.client.List(ctx, a.namespace, list, options); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			key, err := cache.MetaNamespaceKeyFunc(&list.Items[i])
+			if err != nil {
+				return nil, err
+			}
+			live[key] = objectVersion{uid: list.Items[i].UID, resourceVersion: list.Items[i].ResourceVersion}
+		}
+		if list.Continue == "" {
+			return live, nil
+		}
+		options.Continue = list.Continue
+	}
+}
+
+func (a *auditor) compare(live map[string]objectVersion) drift {
+	d := drift{}
+	store := a.cache.GetStore()
+	for _, key := range store.ListKeys() {
+		obj, exists, err := store.GetByKey(key)
+		if err != nil || !exists {
+			continue
+		}
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			continue
+		}
+		cached := objectVersion{uid: m.GetUID(), resourceVersion: m.GetResourceVersion()}
+		version, ok := live[key]
+		switch {
+		case !ok:
+			d[key] = driftEntry{kind: driftExtra, cached: cached}
+		case version != cached:
+			d[key] = driftEntry{kind: driftStale, cached: cached}
+		}
+	}
+	for key := range live {
+		if _, exists, _ := store.GetByKey(key); !exists {
+			d[key] = driftEntry{kind: driftMissing}
+		}
+	}
+	return d
+}
@@ -0,0 +1,52 @@
+package cache_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFactoryAuditsCaches(t *testing.T) {
+	_, caches, ctx := newTestCacheFactory(t, &cache.SharedCacheFactoryOptions{
+		KindAudit: map[schema.GroupVersionKind]cache.AuditOptions{
+			configMapGVK: {
+				Interval: 50 * time.Millisecond,
+				Settle:   10 * time.Millisecond,
+				Relist:   true,
+			},
+		},
+	},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default"}},
+	)
+
+	store := startCache(t, ctx, caches, configMapGVK).GetStore()
+	live, _, err := store.GetByKey("default/b")
+	require.NoError(t, err)
+	liveVersion := live.(*corev1.ConfigMap).ResourceVersion
+
+	// drift the cache like lost watch events would
+	a, _, err := store.GetByKey("default/a")
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(a))
+	require.NoError(t, store.Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "ghost", Namespace: "default", ResourceVersion: "1"}}))
+	stale := live.(*corev1.ConfigMap).DeepCopy()
+	stale.ResourceVersion = "1"
+	require.NoError(t, store.Update(stale))
+
+	// the relist repairs the drift
+	eventually(t, func() bool {
+		keys := store.ListKeys()
+		sort.Strings(keys)
+		b, _, _ := store.GetByKey("default/b")
+		return assert.ObjectsAreEqual([]string{"default/a", "default/b"}, keys) &&
+			b.(*corev1.ConfigMap).ResourceVersion == liveVersion
+	})
+}
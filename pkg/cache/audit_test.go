@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestAuditorCompare(t *testing.T) {
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &corev1.ConfigMap{}, 0, cache.Indexers{})
+	for _, cm := range []*corev1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "same", Namespace: "default", UID: "1", ResourceVersion: "10"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "stale", Namespace: "default", UID: "2", ResourceVersion: "11"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "recreated", Namespace: "default", UID: "3", ResourceVersion: "12"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "extra", Namespace: "default", UID: "4", ResourceVersion: "13"}},
+	} {
+		require.NoError(t, informer.GetStore().Add(cm))
+	}
+	a := &auditor{cache: &deferredCache{SharedIndexInformer: informer}}
+
+	d := a.compare(map[string]objectVersion{
+		"default/same":      {uid: "1", resourceVersion: "10"},
+		"default/stale":     {uid: "2", resourceVersion: "20"},
+		"default/recreated": {uid: "5", resourceVersion: "12"},
+		"default/missing":   {uid: "6", resourceVersion: "21"},
+	})
+	assert.Equal(t, drift{
+		"default/stale":     {kind: driftStale, cached: objectVersion{uid: "2", resourceVersion: "11"}},
+		"default/recreated": {kind: driftStale, cached: objectVersion{uid: "3", resourceVersion: "12"}},
+		"default/extra":     {kind: driftExtra, cached: objectVersion{uid: "4", resourceVersion: "13"}},
+		"default/missing":   {kind: driftMissing},
+	}, d)
+	assert.Equal(t, 2, d.count(driftStale))
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rancher/lasso/pkg/client"
@@ -25,6 +27,20 @@ type Options struct {
 	Resync      time.Duration
 	TweakList   TweakListOptionsFunc
 	WaitHealthy func(ctx context.Context)
+	// Transform is applied to objects before they are stored in the cache, see cache.TransformFunc.
+	Transform cache.TransformFunc
+	// WatchList lists with the streaming list protocol, a watch with sendInitialEvents, instead of a paginated
+	// list. The cache falls back to lists if the apiserver does not support it.
+	WatchList bool
+	// Indexers are added to the cache when it is created.
+	Indexers cache.Indexers
+	// Hooks are notified about the lists and watches of the cache.
+	Hooks Hooks
+
+	// snapshots starts the cache from a snapshot and saves it periodically, it is set by the SharedCacheFactory
+	snapshots *snapshotter
+	// syncs records the lists of the cache, it is set by the SharedCacheFactory
+	syncs *syncState
 }
 
 func NewCache(obj, listObj runtime.Object, client *client.Client, opts *Options) cache.SharedIndexInformer {
@@ -35,6 +51,9 @@ func NewCache(obj, listObj runtime.Object, client *client.Client, opts *Options)
 	}
 
 	opts = applyDefaultCacheOptions(opts)
+	for name, indexFunc := range opts.Indexers {
+		indexers[name] = indexFunc
+	}
 
 	lw := &deferredListWatcher{
 		client:      client,
@@ -42,15 +61,29 @@ func NewCache(obj, listObj runtime.Object, client *client.Client, opts *Options)
 		namespace:   opts.Namespace,
 		listObj:     listObj,
 		waitHealthy: opts.WaitHealthy,
+		snapshots:   opts.snapshots,
+		syncs:       opts.syncs,
+		hooks:       opts.Hooks,
+		watchList:   opts.WatchList,
+	}
+
+	informer := cache.NewSharedIndexInformer(
+		lw,
+		obj,
+		opts.Resync,
+		indexers,
+	)
+	if handler := opts.Hooks.watchErrorHandler(); handler != nil {
+		// the informer is not started yet, so setting the handler cannot fail
+		_ = informer.SetWatchErrorHandler(handler)
+	}
+	if opts.Transform != nil {
+		// the informer is not started yet, so setting the transform cannot fail
+		_ = informer.SetTransform(opts.Transform)
 	}
 
 	return &deferredCache{
-		SharedIndexInformer: cache.NewSharedIndexInformer(
-			lw,
-			obj,
-			opts.Resync,
-			indexers,
-		),
+		SharedIndexInformer: informer,
 		deferredListWatcher: lw,
 	}
 }
@@ -85,6 +118,7 @@ func getDefaultResyncInterval() time.Duration {
 type deferredCache struct {
 	cache.SharedIndexInformer
 	deferredListWatcher *deferredListWatcher
+	started             atomic.Bool
 }
 
 type deferredListWatcher struct {
@@ -94,6 +128,17 @@ type deferredListWatcher struct {
 	namespace   string
 	listObj     runtime.Object
 	waitHealthy func(ctx context.Context)
+	snapshots   *snapshotter
+	syncs       *syncState
+	hooks       Hooks
+	watchList   bool
+
+	// watchLock guards the cancel func of the current watch, relistRequested and watched, see relist. watched is
+	// true if the cache watched since it last listed.
+	watchLock       sync.Mutex
+	cancelWatch     context.CancelFunc
+	relistRequested bool
+	watched         bool
 }
 
 func (d *deferredListWatcher) List(options metav1.ListOptions) (runtime.Object, error) {
@@ -119,28 +164,126 @@ func (d *deferredListWatcher) run(stopCh <-chan struct{}) {
 
 	d.lw = &cache.ListWatch{
 		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-			d.tweakList(&options)
-			// If ResourceVersion is set to 0 then the Limit is ignored on the API side. Usually
-			// that's not a problem, but with very large counts of a single object type the client will
-			// hit it's connection timeout
-			if options.ResourceVersion == "0" {
-				options.ResourceVersion = ""
+			d.watchLock.Lock()
+			d.watched = false
+			d.watchLock.Unlock()
+
+			d.hooks.listStarted()
+			list, err := d.list(ctx, options)
+			if ctx.Err() == nil {
+				d.hooks.listFinished(err)
+				if d.syncs != nil {
+					d.syncs.listed(err)
+				}
 			}
-			listObj := d.listObj.DeepCopyObject()
-			err := d.client.List(ctx, d.namespace, listObj, options)
 			if err != nil && d.waitHealthy != nil {
 				d.waitHealthy(ctx)
 			}
-			return listObj, err
+			return list, err
 		},
 		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			watchCtx, restarted, err := d.nextWatch(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if restarted {
+				d.hooks.watchRestarted()
+			}
 			d.tweakList(&options)
-			return d.client.Watch(ctx, d.namespace, options)
+			return d.client.Watch(watchCtx, d.namespace, options)
 		},
 	}
 }
 
+func (d *deferredListWatcher) list(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+	if d.snapshots != nil {
+		if list, ok := d.snapshots.list(d.listObj, options.ResourceVersion); ok {
+			return list, nil
+		}
+	}
+	d.tweakList(&options)
+	// If ResourceVersion is set to 0 then the Limit is ignored on the API side. Usually
+	// that's not a problem, but with very large counts of a single object type the client will
+	// hit it's connection timeout
+	if options.ResourceVersion == "0" {
+		options.ResourceVersion = ""
+	}
+	if d.watchList {
+		list, err := d.streamList(ctx, options)
+		if err == nil || ctx.Err() != nil {
+			return list, err
+		}
+		if watchListUnsupported(err) {
+			log.Infof("Streaming lists are not supported for %s, falling back to lists: %v", d.client.GVR, err)
+			d.watchList = false
+		} else {
+			log.Debugf("Streaming list of %s failed, falling back to a list: %v", d.client.GVR, err)
+		}
+	}
+	listObj := d.listObj.DeepCopyObject()
+	err := d.client.List(ctx, d.namespace, listObj, options)
+	return listObj, err
+}
+
+// nextWatch returns the context of the next watch and whether it restarts a watch without listing, or an expired
+// error after relist was called so that the informer lists again.
+func (d *deferredListWatcher) nextWatch(ctx context.Context) (context.Context, bool, error) {
+	d.watchLock.Lock()
+	defer d.watchLock.Unlock()
+
+	// the informer only starts a watch after the previous one ended
+	if d.cancelWatch != nil {
+		d.cancelWatch()
+		d.cancelWatch = nil
+	}
+	if d.relistRequested {
+		d.relistRequested = false
+		return nil, false, errRelistRequested
+	}
+	restarted := d.watched
+	d.watched = true
+
+	ctx, d.cancelWatch = context.WithCancel(ctx)
+	return ctx, restarted, nil
+}
+
+// relist stops the current watch, the informer then lists again.
+func (d *deferredListWatcher) relist() {
+	d.watchLock.Lock()
+	defer d.watchLock.Unlock()
+
+	d.relistRequested = true
+	if d.cancelWatch != nil {
+		d.cancelWatch()
+		d.cancelWatch = nil
+	}
+}
+
+// AddIndexers adds indexers to the cache, errors name the package that added them.
+func (d *deferredCache) AddIndexers(indexers cache.Indexers) error {
+	return d.addIndexers(indexers, callerPackage(0))
+}
+
+func (d *deferredCache) addIndexers(indexers cache.Indexers, caller string) error {
+	if err := d.SharedIndexInformer.AddIndexers(indexers); err != nil {
+		return indexersError(d.deferredListWatcher.client.GVR, indexers, caller, d.started.Load(), err)
+	}
+	return nil
+}
+
+// Run runs the cache until stopCh is closed, with snapshots it returns after the final snapshot was saved.
 func (d *deferredCache) Run(stopCh <-chan struct{}) {
+	d.started.Store(true)
 	d.deferredListWatcher.run(stopCh)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	if snapshots := d.deferredListWatcher.snapshots; snapshots != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snapshots.run(stopCh, d.SharedIndexInformer, d.deferredListWatcher.listObj)
+		}()
+	}
 	d.SharedIndexInformer.Run(stopCh)
 }
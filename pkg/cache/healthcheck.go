@@ -2,33 +2,114 @@ package cache
 
 import (
 	"context"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/log"
+	"github.com/rancher/lasso/pkg/metrics"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
+// HealthSubscriber is implemented by the SharedCacheFactory returned by NewSharedCachedFactory.
+type HealthSubscriber interface {
+	// SubscribeHealth returns a channel that receives the apiserver health whenever it changes, starting with the
+	// current health once it is known. Slow receivers miss intermediate changes instead of blocking the health
+	// checks. The channel is closed when ctx is cancelled.
+	SubscribeHealth(ctx context.Context) <-chan bool
+}
+
+// SubscribeHealth subscribes to the apiserver health of the factory, see HealthSubscriber. For factories that do
+// not report their health the channel never receives and is closed when ctx is cancelled.
+func SubscribeHealth(ctx context.Context, factory SharedCacheFactory) <-chan bool {
+	if subscriber, ok := factory.(HealthSubscriber); ok {
+		return subscriber.SubscribeHealth(ctx)
+	}
+	ch := make(chan bool)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch
+}
+
 const (
-	defaultTimeout = 15 * time.Second
+	defaultTimeout        = 15 * time.Second
+	defaultHealthEndpoint = "/version"
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 30 * time.Second
+	defaultBackoffJitter  = 0.2
 )
 
+// HealthCheckOptions configures how the shared cache factory probes the apiserver. The apiserver is probed when
+// the factory is started and whenever a cache fails to list, the caches wait with listing until a probe succeeds.
+type HealthCheckOptions struct {
+	// Endpoint is the path of the apiserver that is probed, for example /readyz, /livez or /version. Defaults to
+	// /version.
+	Endpoint string
+	// Timeout of a single probe. Defaults to 15 seconds.
+	Timeout time.Duration
+	// InitialBackoff is the delay after the first failed probe, it doubles after every further failure up to
+	// MaxBackoff. Defaults to 1 second and 30 seconds.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter randomly extends the delays by up to the given fraction. Defaults to 0.2.
+	Jitter float64
+}
+
+func applyHealthCheckDefaults(opts HealthCheckOptions) HealthCheckOptions {
+	if opts.Endpoint == "" {
+		opts.Endpoint = defaultHealthEndpoint
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.InitialBackoff == 0 {
+		opts.InitialBackoff = defaultInitialBackoff
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	if opts.Jitter == 0 {
+		opts.Jitter = defaultBackoffJitter
+	}
+	return opts
+}
+
 type healthcheck struct {
 	lock     sync.Mutex
 	cf       client.SharedClientFactory
 	callback func(bool)
+	opts     HealthCheckOptions
+
+	// ctx is the context of the factory, probes stop when it is cancelled
+	ctx       context.Context
+	contextID string
+	// healthy is the result of the last probe, known is false until the first probe finished
+	healthy bool
+	known   bool
+	// probing is true while a probe loop runs, ready is closed when it succeeds
+	probing     bool
+	ready       chan struct{}
+	subscribers map[chan bool]struct{}
 }
 
 func (h *healthcheck) ping(ctx context.Context) bool {
-	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	ctx, cancel := context.WithTimeout(ctx, h.opts.Timeout)
 	defer cancel()
 	if h.cf == nil {
 		return false
 	}
-	return h.cf.IsHealthy(ctx)
+	if err := client.Probe(ctx, h.cf, h.opts.Endpoint); err != nil {
+		log.Debugf("apiserver health probe of %s failed: %v", h.opts.Endpoint, err)
+		return false
+	}
+	return true
 }
 
 func (h *healthcheck) start(ctx context.Context, cf client.SharedClientFactory) error {
-	first, err := h.initialize(cf)
+	first, err := h.initialize(ctx, cf)
 	if err != nil {
 		return err
 	}
@@ -38,7 +119,7 @@ func (h *healthcheck) start(ctx context.Context, cf client.SharedClientFactory)
 	return nil
 }
 
-func (h *healthcheck) initialize(cf client.SharedClientFactory) (bool, error) {
+func (h *healthcheck) initialize(ctx context.Context, cf client.SharedClientFactory) (bool, error) {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 	if h.cf != nil {
@@ -46,29 +127,117 @@ func (h *healthcheck) initialize(cf client.SharedClientFactory) (bool, error) {
 	}
 
 	h.cf = cf
+	h.ctx = ctx
+	h.contextID = metrics.ContextID(ctx)
 	return true, nil
 }
 
+// ensureHealthy probes the apiserver and waits until it is healthy or ctx is cancelled. Concurrent callers share
+// one probe loop instead of probing one after another.
 func (h *healthcheck) ensureHealthy(ctx context.Context) {
 	h.lock.Lock()
-	defer h.lock.Unlock()
-	h.pingUntilGood(ctx)
+	if h.cf == nil {
+		// the factory was not started, there is nothing to wait for
+		h.lock.Unlock()
+		return
+	}
+	if !h.probing {
+		h.probing = true
+		h.ready = make(chan struct{})
+		go h.probe(h.ctx, h.ready)
+	}
+	ready, stop := h.ready, h.ctx.Done()
+	h.lock.Unlock()
+
+	select {
+	case <-ready:
+	case <-ctx.Done():
+	case <-stop:
+	}
+}
+
+// probe pings the apiserver with exponential backoff until it succeeds or ctx is cancelled.
+func (h *healthcheck) probe(ctx context.Context, ready chan struct{}) {
+	backoff := wait.Backoff{
+		Duration: h.opts.InitialBackoff,
+		Factor:   2,
+		Jitter:   h.opts.Jitter,
+		Steps:    math.MaxInt32,
+		Cap:      h.opts.MaxBackoff,
+	}
+	for {
+		healthy := h.ping(ctx)
+		h.report(healthy)
+		if healthy {
+			h.lock.Lock()
+			h.probing = false
+			h.lock.Unlock()
+			close(ready)
+			return
+		}
+
+		timer := time.NewTimer(backoff.Step())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			h.lock.Lock()
+			h.probing = false
+			h.lock.Unlock()
+			return
+		case <-timer.C:
+		}
+	}
 }
 
 func (h *healthcheck) report(good bool) {
+	h.lock.Lock()
+	changed := !h.known || h.healthy != good
+	if h.known && changed {
+		metrics.IncAPIServerHealthTransitions(h.contextID, good)
+	}
+	h.known, h.healthy = true, good
+	if changed {
+		for ch := range h.subscribers {
+			notify(ch, good)
+		}
+	}
+	h.lock.Unlock()
+
 	if h.callback != nil {
 		h.callback(good)
 	}
 }
 
-func (h *healthcheck) pingUntilGood(ctx context.Context) {
-	for {
-		if h.ping(ctx) {
-			h.report(true)
-			return
-		}
+// subscribe returns a channel that receives the health of the apiserver whenever it changes, starting with the
+// current health once it is known. Slow receivers miss intermediate changes instead of blocking the probes. The
+// channel is closed when ctx is cancelled.
+func (h *healthcheck) subscribe(ctx context.Context) <-chan bool {
+	ch := make(chan bool, 1)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.subscribers == nil {
+		h.subscribers = map[chan bool]struct{}{}
+	}
+	h.subscribers[ch] = struct{}{}
+	if h.known {
+		notify(ch, h.healthy)
+	}
+
+	context.AfterFunc(ctx, func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		delete(h.subscribers, ch)
+		close(ch)
+	})
+	return ch
+}
 
-		h.report(false)
-		time.Sleep(defaultTimeout)
+// notify replaces an unreceived value of the subscriber with the new one, the caller must hold h.lock.
+func notify(ch chan bool, healthy bool) {
+	select {
+	case <-ch:
+	default:
 	}
+	ch <- healthy
 }
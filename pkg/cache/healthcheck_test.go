@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// probingClientFactory is a client factory whose probes are mocked separately.
+type probingClientFactory struct {
+	*MockSharedClientFactory
+	*MockProbingClientFactory
+}
+
+func newTestHealthcheck(t *testing.T) (*healthcheck, client.SharedClientFactory, *MockProbingClientFactory) {
+	ctrl := gomock.NewController(t)
+	probes := NewMockProbingClientFactory(ctrl)
+	return &healthcheck{
+		opts: applyHealthCheckDefaults(HealthCheckOptions{
+			Endpoint:       "/readyz",
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     5 * time.Millisecond,
+		}),
+	}, probingClientFactory{NewMockSharedClientFactory(ctrl), probes}, probes
+}
+
+func TestHealthcheckBacksOffUntilHealthy(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics.MustRegister(reg)
+
+	h, cf, probes := newTestHealthcheck(t)
+	gomock.InOrder(
+		probes.EXPECT().Probe(gomock.Any(), "/readyz").Return(errors.New("not ready")).Times(3),
+		probes.EXPECT().Probe(gomock.Any(), "/readyz").Return(nil),
+	)
+
+	ctx, cancel := context.WithCancel(metrics.WithContextID(context.Background(), "health-test"))
+	defer cancel()
+
+	var reports []bool
+	h.callback = func(healthy bool) {
+		reports = append(reports, healthy)
+	}
+	updates := h.subscribe(ctx)
+
+	require.NoError(t, h.start(ctx, cf))
+	assert.Equal(t, []bool{false, false, false, true}, reports)
+	assert.True(t, <-updates)
+	assert.Equal(t, 1.0, counterValue(t, reg, "lasso_controller_apiserver_health_transitions_total", map[string]string{
+		"ctx":   "health-test",
+		"state": "healthy",
+	}))
+
+	// healthy apiservers are probed once per caller
+	probes.EXPECT().Probe(gomock.Any(), "/readyz").Return(nil)
+	h.ensureHealthy(ctx)
+
+	cancel()
+	_, ok := <-updates
+	assert.False(t, ok)
+}
+
+func TestHealthcheckStopsWithContext(t *testing.T) {
+	h, cf, probes := newTestHealthcheck(t)
+	probes.EXPECT().Probe(gomock.Any(), "/readyz").Return(errors.New("not ready")).AnyTimes()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, h.start(ctx, cf))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the health check did not stop with its context")
+	}
+	assert.Eventually(t, func() bool {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		return !h.probing
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestHealthcheckWithoutProbes(t *testing.T) {
+	h, _, _ := newTestHealthcheck(t)
+	cf := NewMockSharedClientFactory(gomock.NewController(t))
+	h.cf = cf
+
+	// factories that can not probe the endpoint report whether they are healthy
+	cf.EXPECT().IsHealthy(gomock.Any()).Return(false)
+	assert.False(t, h.ping(context.Background()))
+	cf.EXPECT().IsHealthy(gomock.Any()).Return(true)
+	assert.True(t, h.ping(context.Background()))
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"errors"
+	"io"
+
+	"github.com/rancher/lasso/pkg/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// errRelistRequested ends the watch of a cache after relist was called, it is not reported to the hooks.
+var errRelistRequested = apierrors.NewResourceExpired("relist requested")
+
+// Hooks are notified about the lists and watches of a cache, for example to alert on caches that relist
+// constantly. They are called by the informer and must not block. Unset hooks are skipped.
+type Hooks struct {
+	// WatchErrorHandler is called with the errors that end a list or watch of the cache, instead of client-go's
+	// cache.DefaultWatchErrorHandler which logs them. See cache.SharedIndexInformer.SetWatchErrorHandler.
+	WatchErrorHandler cache.WatchErrorHandler
+	// ListStarted and ListFinished are called around every list of the cache, lists after the initial one are
+	// relists.
+	ListStarted  func()
+	ListFinished func(err error)
+	// WatchRestarted is called when a watch ended and the cache watches again without listing.
+	WatchRestarted func()
+	// ResourceVersionExpired is called when a list or watch failed because its resourceVersion is too old, a 410
+	// Gone, and the cache lists again.
+	ResourceVersionExpired func()
+}
+
+func (h Hooks) listStarted() {
+	if h.ListStarted != nil {
+		h.ListStarted()
+	}
+}
+
+func (h Hooks) listFinished(err error) {
+	if h.ListFinished != nil {
+		h.ListFinished(err)
+	}
+	if isExpired(err) && h.ResourceVersionExpired != nil {
+		h.ResourceVersionExpired()
+	}
+}
+
+func (h Hooks) watchRestarted() {
+	if h.WatchRestarted != nil {
+		h.WatchRestarted()
+	}
+}
+
+// watchErrorHandler reports expired resourceVersions and passes the errors on to the WatchErrorHandler. Without
+// watch hooks it returns nil and the informer keeps client-go's handler.
+func (h Hooks) watchErrorHandler() cache.WatchErrorHandler {
+	if h.WatchErrorHandler == nil && h.ResourceVersionExpired == nil {
+		return nil
+	}
+	handler := h.WatchErrorHandler
+	if handler == nil {
+		handler = cache.DefaultWatchErrorHandler
+	}
+	return func(r *cache.Reflector, err error) {
+		// relists requested by the audits are not errors
+		if errors.Is(err, errRelistRequested) {
+			return
+		}
+		// the reflector retries expired lists itself, so expired errors are from watches
+		if isExpired(err) && h.ResourceVersionExpired != nil {
+			h.ResourceVersionExpired()
+		}
+		handler(r, err)
+	}
+}
+
+func isExpired(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+// measureHooks counts the lists, watch restarts and watch errors of the cache before calling the hooks.
+func measureHooks(gvk schema.GroupVersionKind, hooks Hooks) Hooks {
+	measured := hooks
+	measured.ListFinished = func(err error) {
+		metrics.IncCacheLists(gvk, err == nil)
+		if hooks.ListFinished != nil {
+			hooks.ListFinished(err)
+		}
+	}
+	measured.WatchRestarted = func() {
+		metrics.IncCacheWatchRestarts(gvk)
+		if hooks.WatchRestarted != nil {
+			hooks.WatchRestarted()
+		}
+	}
+	measured.WatchErrorHandler = func(r *cache.Reflector, err error) {
+		// watches closed by the apiserver are no errors
+		if err != io.EOF {
+			metrics.IncCacheWatchErrors(gvk, isExpired(err))
+		}
+		if hooks.WatchErrorHandler != nil {
+			hooks.WatchErrorHandler(r, err)
+		} else {
+			cache.DefaultWatchErrorHandler(r, err)
+		}
+	}
+	return measured
+}
@@ -0,0 +1,67 @@
+package cache_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgocache "k8s.io/client-go/tools/cache"
+)
+
+func TestFactoryCacheHooks(t *testing.T) {
+	secretGVK := corev1.SchemeGroupVersion.WithKind("Secret")
+
+	var (
+		lock        sync.Mutex
+		listed      []error
+		listStarts  int
+		watchErrors []error
+	)
+	f, caches, ctx := newTestCacheFactory(t, &cache.SharedCacheFactoryOptions{
+		DefaultHooks: cache.Hooks{
+			WatchErrorHandler: func(_ *clientgocache.Reflector, err error) {
+				lock.Lock()
+				defer lock.Unlock()
+				watchErrors = append(watchErrors, err)
+			},
+		},
+		KindHooks: map[schema.GroupVersionKind]cache.Hooks{
+			configMapGVK: {
+				ListStarted: func() {
+					lock.Lock()
+					defer lock.Unlock()
+					listStarts++
+				},
+				ListFinished: func(err error) {
+					lock.Lock()
+					defer lock.Unlock()
+					listed = append(listed, err)
+				},
+			},
+		},
+	}, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}})
+	require.NoError(t, f.Forbid(secretGVK, true))
+
+	_, err := caches.ForKind(secretGVK)
+	require.NoError(t, err)
+	startCache(t, ctx, caches, configMapGVK)
+	require.NoError(t, caches.StartGVK(ctx, secretGVK))
+
+	lock.Lock()
+	assert.Equal(t, 1, listStarts)
+	assert.Equal(t, []error{nil}, listed)
+	lock.Unlock()
+
+	// the secrets use the default hooks, their failed lists end up in the watch error handler
+	eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(watchErrors) > 0 && apierrors.IsForbidden(watchErrors[0])
+	})
+}
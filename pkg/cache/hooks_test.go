@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher/lasso/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestHooksWatchErrorHandler(t *testing.T) {
+	var (
+		handled []error
+		expired int
+	)
+	handler := Hooks{
+		WatchErrorHandler: func(_ *cache.Reflector, err error) {
+			handled = append(handled, err)
+		},
+		ResourceVersionExpired: func() {
+			expired++
+		},
+	}.watchErrorHandler()
+
+	handler(nil, errRelistRequested)
+	handler(nil, fmt.Errorf("watch ended: %w", errRelistRequested))
+	assert.Empty(t, handled)
+	assert.Zero(t, expired)
+
+	gone := apierrors.NewResourceExpired("too old resource version")
+	failed := errors.New("connection refused")
+	handler(nil, gone)
+	handler(nil, failed)
+	assert.Equal(t, []error{gone, failed}, handled)
+	assert.Equal(t, 1, expired)
+
+	// without watch hooks the informer keeps client-go's handler
+	assert.Nil(t, Hooks{ListStarted: func() {}}.watchErrorHandler())
+	assert.NotNil(t, Hooks{ResourceVersionExpired: func() {}}.watchErrorHandler())
+}
+
+func TestNextWatchRestarts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := &deferredListWatcher{}
+	_, restarted, err := d.nextWatch(ctx)
+	require.NoError(t, err)
+	assert.False(t, restarted)
+	_, restarted, err = d.nextWatch(ctx)
+	require.NoError(t, err)
+	assert.True(t, restarted)
+
+	d.relist()
+	_, _, err = d.nextWatch(ctx)
+	assert.ErrorIs(t, err, errRelistRequested)
+}
+
+func TestMeasureHooks(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics.MustRegister(reg)
+
+	gvk := schema.GroupVersionKind{Group: "hooks.test", Version: "v1", Kind: "Measured"}
+	labels := map[string]string{"group": gvk.Group, "version": gvk.Version, "kind": gvk.Kind}
+	withLabel := func(name, value string) map[string]string {
+		result := map[string]string{name: value}
+		for k, v := range labels {
+			result[k] = v
+		}
+		return result
+	}
+
+	var lists, restarts, watchErrors int
+	hooks := measureHooks(gvk, Hooks{
+		ListFinished:      func(error) { lists++ },
+		WatchRestarted:    func() { restarts++ },
+		WatchErrorHandler: func(*cache.Reflector, error) { watchErrors++ },
+	})
+	hooks.ListFinished(nil)
+	hooks.ListFinished(errors.New("forbidden"))
+	hooks.WatchRestarted()
+	hooks.WatchErrorHandler(nil, io.EOF)
+	hooks.WatchErrorHandler(nil, apierrors.NewResourceExpired("too old resource version"))
+	hooks.WatchErrorHandler(nil, errors.New("connection refused"))
+
+	assert.Equal(t, 2, lists)
+	assert.Equal(t, 1, restarts)
+	assert.Equal(t, 3, watchErrors)
+	assert.Equal(t, 1., counterValue(t, reg, "lasso_controller_cache_lists_total", withLabel("result", "success")))
+	assert.Equal(t, 1., counterValue(t, reg, "lasso_controller_cache_lists_total", withLabel("result", "error")))
+	assert.Equal(t, 1., counterValue(t, reg, "lasso_controller_cache_watch_restarts_total", labels))
+	assert.Equal(t, 1., counterValue(t, reg, "lasso_controller_cache_watch_errors_total", withLabel("expired", "true")))
+	assert.Equal(t, 1., counterValue(t, reg, "lasso_controller_cache_watch_errors_total", withLabel("expired", "false")))
+}
@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// OwnerUIDIndex is the name conventionally used for OwnerUIDIndexFunc.
+	OwnerUIDIndex = "lasso.cattle.io/owner-uid"
+	// ControllerOwnerIndex is the name conventionally used for ControllerOwnerIndexFunc.
+	ControllerOwnerIndex = "lasso.cattle.io/controller-owner"
+	// LabelIndex is the name conventionally used for LabelIndexFunc.
+	LabelIndex = "lasso.cattle.io/label"
+)
+
+// OwnerUIDIndexFunc indexes objects by the UIDs of their owners.
+func OwnerUIDIndexFunc(obj interface{}) ([]string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	var uids []string
+	for _, owner := range m.GetOwnerReferences() {
+		uids = append(uids, string(owner.UID))
+	}
+	return uids, nil
+}
+
+// ControllerOwnerIndexFunc indexes objects by their controller owner, the index values are built with
+// ControllerOwnerKey.
+func ControllerOwnerIndexFunc(obj interface{}) ([]string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	owner := metav1.GetControllerOfNoCopy(m)
+	if owner == nil {
+		return nil, nil
+	}
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	return []string{ControllerOwnerKey(gv.WithKind(owner.Kind).GroupKind(), m.GetNamespace(), owner.Name)}, nil
+}
+
+// ControllerOwnerKey returns the value ControllerOwnerIndexFunc indexes the objects controlled by the given owner
+// with. namespace is the namespace of the owned objects, owners are either in the same namespace or cluster scoped.
+func ControllerOwnerKey(owner schema.GroupKind, namespace, name string) string {
+	if namespace == "" {
+		return owner.String() + "/" + name
+	}
+	return owner.String() + "/" + namespace + "/" + name
+}
+
+// LabelIndexFunc returns an index function that indexes objects by "key=value" for each of the label keys, or for
+// every label if no keys are given.
+func LabelIndexFunc(keys ...string) cache.IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		labels := m.GetLabels()
+
+		var values []string
+		if len(keys) == 0 {
+			for key, value := range labels {
+				values = append(values, key+"="+value)
+			}
+			sort.Strings(values)
+			return values, nil
+		}
+		for _, key := range keys {
+			if value, ok := labels[key]; ok {
+				values = append(values, key+"="+value)
+			}
+		}
+		return values, nil
+	}
+}
+
+// FieldPathIndexFunc returns an index function that indexes unstructured objects by the value at the field path,
+// for example FieldPathIndexFunc("spec", "nodeName"). Strings, numbers and booleans are indexed by their string
+// form, lists of them by each element. Other objects and missing fields are not indexed.
+func FieldPathIndexFunc(fields ...string) cache.IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, nil
+		}
+		value, found, err := unstructured.NestedFieldNoCopy(u.Object, fields...)
+		if !found || err != nil {
+			return nil, nil
+		}
+		if list, ok := value.([]interface{}); ok {
+			var values []string
+			for _, item := range list {
+				if s, ok := scalarString(item); ok {
+					values = append(values, s)
+				}
+			}
+			return values, nil
+		}
+		if s, ok := scalarString(value); ok {
+			return []string{s}, nil
+		}
+		return nil, nil
+	}
+}
+
+func scalarString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool, int64, float64:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// indexersError explains which indexers could not be added to a cache and who added them, indexers added after
+// the cache started often conflict with the indexers registered by other packages.
+func indexersError(resource schema.GroupVersionResource, indexers cache.Indexers, caller string, started bool, err error) error {
+	names := make([]string, 0, len(indexers))
+	for name := range indexers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !started {
+		return fmt.Errorf("adding indexers %s to the cache of %s from %s: %w", strings.Join(names, ","), resource, caller, err)
+	}
+	return fmt.Errorf("adding indexers %s to the cache of %s from %s after it started, register them with "+
+		"SharedCacheFactoryOptions.KindIndexers instead: %w", strings.Join(names, ","), resource, caller, err)
+}
+
+// callerPackage returns the package of the function skip frames above the caller of callerPackage.
+func callerPackage(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 2)
+	if !ok {
+		return "unknown"
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "unknown"
+	}
+	// function names look like github.com/rancher/lasso/pkg/cache.(*deferredCache).AddIndexers
+	name := fn.Name()
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		return name[:slash+1+dot]
+	}
+	return name
+}
@@ -0,0 +1,45 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgocache "k8s.io/client-go/tools/cache"
+)
+
+func TestFactoryIndexers(t *testing.T) {
+	_, caches, ctx := newTestCacheFactory(t, &cache.SharedCacheFactoryOptions{
+		DefaultIndexers: clientgocache.Indexers{
+			cache.LabelIndex: cache.LabelIndexFunc("app"),
+		},
+		KindIndexers: map[schema.GroupVersionKind]clientgocache.Indexers{
+			configMapGVK: {cache.OwnerUIDIndex: cache.OwnerUIDIndexFunc},
+		},
+	}, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:            "cm",
+		Namespace:       "default",
+		Labels:          map[string]string{"app": "web"},
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "Secret", Name: "owner", UID: "owner-uid"}},
+	}})
+
+	informer := startCache(t, ctx, caches, configMapGVK)
+	byLabel, err := informer.GetIndexer().ByIndex(cache.LabelIndex, "app=web")
+	require.NoError(t, err)
+	assert.Len(t, byLabel, 1)
+	byOwner, err := informer.GetIndexer().ByIndex(cache.OwnerUIDIndex, "owner-uid")
+	require.NoError(t, err)
+	assert.Len(t, byOwner, 1)
+
+	// new indexers index the cached objects when they are added
+	require.NoError(t, informer.AddIndexers(clientgocache.Indexers{"late": cache.ControllerOwnerIndexFunc}))
+
+	err = informer.AddIndexers(clientgocache.Indexers{cache.OwnerUIDIndex: cache.OwnerUIDIndexFunc})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "adding indexers lasso.cattle.io/owner-uid to the cache of /v1, Resource=configmaps from github.com/rancher/lasso/pkg/cache_test after it started")
+	assert.ErrorContains(t, err, "indexer conflict")
+}
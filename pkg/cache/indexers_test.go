@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/ptr"
+)
+
+func TestIndexers(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "pod",
+		Namespace: "default",
+		Labels:    map[string]string{"app": "web", "tier": "frontend"},
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web", UID: "rs-uid", Controller: ptr.To(true)},
+			{APIVersion: "v1", Kind: "ConfigMap", Name: "config", UID: "cm-uid"},
+		},
+	}}
+
+	values, err := OwnerUIDIndexFunc(pod)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rs-uid", "cm-uid"}, values)
+
+	values, err = ControllerOwnerIndexFunc(pod)
+	require.NoError(t, err)
+	assert.Equal(t, []string{ControllerOwnerKey(appsv1.SchemeGroupVersion.WithKind("ReplicaSet").GroupKind(), "default", "web")}, values)
+	assert.Equal(t, []string{"ReplicaSet.apps/default/web"}, values)
+
+	values, err = ControllerOwnerIndexFunc(&corev1.Pod{})
+	require.NoError(t, err)
+	assert.Empty(t, values)
+
+	values, err = LabelIndexFunc()(pod)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app=web", "tier=frontend"}, values)
+
+	values, err = LabelIndexFunc("tier", "missing")(pod)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tier=frontend"}, values)
+
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"nodeName": "node1",
+			"replicas": int64(3),
+			"hosts":    []interface{}{"a", "b"},
+			"template": map[string]interface{}{},
+		},
+	}}
+	for _, tc := range []struct {
+		path     []string
+		expected []string
+	}{
+		{path: []string{"spec", "nodeName"}, expected: []string{"node1"}},
+		{path: []string{"spec", "replicas"}, expected: []string{"3"}},
+		{path: []string{"spec", "hosts"}, expected: []string{"a", "b"}},
+		{path: []string{"spec", "template"}},
+		{path: []string{"spec", "missing"}},
+	} {
+		values, err := FieldPathIndexFunc(tc.path...)(u)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, values, tc.path)
+	}
+	values, err = FieldPathIndexFunc("spec", "nodeName")(pod)
+	require.NoError(t, err)
+	assert.Empty(t, values)
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+type ListerOptions struct {
+	// DeepCopy makes the lister return copies of the cached objects, which callers may modify. Without it the
+	// cached objects are returned and must not be modified.
+	DeepCopy bool
+}
+
+// Lister reads the objects of type T from a cache, for example *corev1.Pod or *unstructured.Unstructured.
+type Lister[T runtime.Object] struct {
+	indexer  cache.Indexer
+	resource schema.GroupResource
+	deepCopy bool
+}
+
+// NewLister returns a lister reading from the informer. resource is used in the NotFound errors of Get.
+func NewLister[T runtime.Object](informer cache.SharedIndexInformer, resource schema.GroupResource, opts *ListerOptions) *Lister[T] {
+	if opts == nil {
+		opts = &ListerOptions{}
+	}
+	return &Lister[T]{
+		indexer:  informer.GetIndexer(),
+		resource: resource,
+		deepCopy: opts.DeepCopy,
+	}
+}
+
+// NewListerForKind returns a lister reading from the factory's cache of the kind.
+func NewListerForKind[T runtime.Object](factory SharedCacheFactory, gvk schema.GroupVersionKind, opts *ListerOptions) (*Lister[T], error) {
+	gvr, _, err := factory.SharedClientFactory().ResourceForGVK(gvk)
+	if err != nil {
+		return nil, err
+	}
+	informer, err := factory.ForKind(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return NewLister[T](informer, gvr.GroupResource(), opts), nil
+}
+
+// Get returns the object with the given namespace and name, namespace is empty for cluster scoped objects. It
+// returns a NotFound error if the object is not cached.
+func (l *Lister[T]) Get(namespace, name string) (T, error) {
+	var zero T
+
+	key := name
+	if namespace != "" {
+		key = namespace + "/" + name
+	}
+
+	obj, exists, err := l.indexer.GetByKey(key)
+	if err != nil {
+		return zero, err
+	}
+	if !exists {
+		return zero, apierrors.NewNotFound(l.resource, name)
+	}
+	return l.convert(obj)
+}
+
+// List returns the objects in the namespace, or in all namespaces if it is empty, that match the selector. A nil
+// selector matches every object.
+func (l *Lister[T]) List(namespace string, selector labels.Selector) ([]T, error) {
+	if selector == nil {
+		selector = labels.Everything()
+	}
+
+	var (
+		result  []T
+		listErr error
+	)
+	err := cache.ListAllByNamespace(l.indexer, namespace, selector, func(obj interface{}) {
+		if listErr != nil {
+			return
+		}
+		t, err := l.convert(obj)
+		if err != nil {
+			listErr = err
+			return
+		}
+		result = append(result, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, listErr
+}
+
+// ByIndex returns the objects whose index values include value.
+func (l *Lister[T]) ByIndex(index, value string) ([]T, error) {
+	objs, err := l.indexer.ByIndex(index, value)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]T, 0, len(objs))
+	for _, obj := range objs {
+		t, err := l.convert(obj)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+func (l *Lister[T]) convert(obj interface{}) (T, error) {
+	t, ok := obj.(T)
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("cached %s object is %T, not %T", l.resource, obj, zero)
+	}
+	if l.deepCopy {
+		t = t.DeepCopyObject().(T)
+	}
+	return t, nil
+}
@@ -0,0 +1,40 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFactoryListers(t *testing.T) {
+	_, caches, ctx := newTestCacheFactory(t, nil,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}},
+	)
+
+	lister, err := cache.NewListerForKind[*corev1.ConfigMap](caches, configMapGVK, nil)
+	require.NoError(t, err)
+	copyingLister, err := cache.NewListerForKind[*corev1.ConfigMap](caches, configMapGVK, &cache.ListerOptions{DeepCopy: true})
+	require.NoError(t, err)
+	startCache(t, ctx, caches, configMapGVK)
+
+	cm, err := lister.Get("default", "cm")
+	require.NoError(t, err)
+	assert.Equal(t, "cm", cm.Name)
+	same, err := lister.Get("default", "cm")
+	require.NoError(t, err)
+	assert.Same(t, cm, same)
+
+	cmCopy, err := copyingLister.Get("default", "cm")
+	require.NoError(t, err)
+	assert.Equal(t, cm, cmCopy)
+	assert.NotSame(t, cm, cmCopy)
+
+	_, err = lister.Get("default", "missing")
+	assert.True(t, apierrors.IsNotFound(err))
+	assert.ErrorContains(t, err, `configmaps "missing" not found`)
+}
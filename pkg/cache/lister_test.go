@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestLister(t *testing.T) {
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &corev1.ConfigMap{}, 0, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+	for _, cm := range []*corev1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "blue", Namespace: "a", Labels: map[string]string{"color": "blue"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "red", Namespace: "a", Labels: map[string]string{"color": "red"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "blue", Namespace: "b", Labels: map[string]string{"color": "blue"}}},
+	} {
+		require.NoError(t, informer.GetStore().Add(cm))
+	}
+	resource := corev1.Resource("configmaps")
+
+	lister := NewLister[*corev1.ConfigMap](informer, resource, nil)
+	cm, err := lister.Get("a", "red")
+	require.NoError(t, err)
+	assert.Equal(t, "red", cm.Name)
+	cached, _, _ := informer.GetStore().GetByKey("a/red")
+	assert.Same(t, cached, cm)
+
+	_, err = lister.Get("b", "red")
+	assert.True(t, apierrors.IsNotFound(err))
+
+	all, err := lister.List("", nil)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	blue, err := lister.List("", labels.SelectorFromSet(labels.Set{"color": "blue"}))
+	require.NoError(t, err)
+	assert.Len(t, blue, 2)
+
+	inA, err := lister.ByIndex(cache.NamespaceIndex, "a")
+	require.NoError(t, err)
+	assert.Len(t, inA, 2)
+
+	copies := NewLister[*corev1.ConfigMap](informer, resource, &ListerOptions{DeepCopy: true})
+	cm, err = copies.Get("a", "red")
+	require.NoError(t, err)
+	assert.NotSame(t, cached, cm)
+	assert.Equal(t, cached, cm)
+
+	_, err = NewLister[*corev1.Pod](informer, resource, nil).Get("a", "red")
+	assert.ErrorContains(t, err, "is *v1.ConfigMap, not *v1.Pod")
+}
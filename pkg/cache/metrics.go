@@ -7,31 +7,100 @@ import (
 
 	"github.com/rancher/lasso/pkg/metrics"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
 )
 
 const (
 	defaultCacheMetricsCollectionPeriod = 1 * time.Minute
+
+	informersActive = "active"
+	informersIdle   = "idle"
+
+	// cacheSizeSamples is the number of objects per cache whose size is measured to estimate the cache's size
+	cacheSizeSamples = 50
 )
 
+// CacheStats describes the objects cached for a kind.
+type CacheStats struct {
+	// Objects is the number of cached objects, objects in several scoped caches of a kind are counted once per
+	// cache.
+	Objects int
+	// ApproximateBytes estimates the size of the cached objects from the serialized size of a sample of them.
+	ApproximateBytes int64
+}
+
+// StatsReporter is implemented by the SharedCacheFactory returned by NewSharedCachedFactory.
+type StatsReporter interface {
+	// CacheStats returns the number and approximate size of the cached objects per kind.
+	CacheStats() map[schema.GroupVersionKind]CacheStats
+}
+
+func (f *sharedCacheFactory) CacheStats() map[schema.GroupVersionKind]CacheStats {
+	f.lock.RLock()
+	caches := maps.Clone(f.caches)
+	f.lock.RUnlock()
+
+	stats := map[schema.GroupVersionKind]CacheStats{}
+	for key, c := range caches {
+		cacheStats := storeStats(c.GetStore())
+		total := stats[key.gvk]
+		total.Objects += cacheStats.Objects
+		total.ApproximateBytes += cacheStats.ApproximateBytes
+		stats[key.gvk] = total
+	}
+	return stats
+}
+
+// storeStats counts the objects of the store by their keys, which does not copy the objects like List, and
+// extrapolates their size from evenly spread samples.
+func storeStats(store cache.Store) CacheStats {
+	keys := store.ListKeys()
+	stats := CacheStats{Objects: len(keys)}
+	if len(keys) == 0 {
+		return stats
+	}
+
+	samples := min(len(keys), cacheSizeSamples)
+	var sampled, size int64
+	for i := 0; i < samples; i++ {
+		obj, exists, err := store.GetByKey(keys[i*len(keys)/samples])
+		if err != nil || !exists {
+			continue
+		}
+		sampled++
+		size += int64(objectSize(obj))
+	}
+	if sampled > 0 {
+		stats.ApproximateBytes = size * int64(len(keys)) / sampled
+	}
+	return stats
+}
+
 func (f *sharedCacheFactory) collectMetrics() sharedCacheFactoryMetrics {
 	// f.lock prevents concurrent read and write to the f.caches map
 	// Listing the cache store could be slow, so here we get a local copy of the map to minimize the locking time
 	f.lock.RLock()
-	caches := maps.Clone(f.caches)
+	informers := map[string]int{}
+	for key := range f.startedCaches {
+		if f.pinned[key] || f.refs[key] > 0 {
+			informers[informersActive]++
+		} else {
+			informers[informersIdle]++
+		}
+	}
 	f.lock.RUnlock()
 
-	gvks := make(map[schema.GroupVersionKind]int)
-	for gvk, c := range caches {
-		gvks[gvk] = len(c.GetStore().List())
-	}
 	return sharedCacheFactoryMetrics{
-		gvks: gvks,
+		gvks:      f.CacheStats(),
+		informers: informers,
 	}
 }
 
 type sharedCacheFactoryMetrics struct {
-	// gvks is the total count of cache items by GroupVersionKind
-	gvks map[schema.GroupVersionKind]int
+	// gvks is the total count and size of cache items by GroupVersionKind
+	gvks map[schema.GroupVersionKind]CacheStats
+	// informers is the count of running caches by state
+	informers map[string]int
 }
 
 func (f *sharedCacheFactory) startMetricsCollection(ctx context.Context) {
@@ -39,9 +108,18 @@ func (f *sharedCacheFactory) startMetricsCollection(ctx context.Context) {
 		contextID := metrics.ContextID(ctx)
 		timer := time.NewTimer(f.metricsCollectionPeriod)
 		defer timer.Stop()
+		var previous sharedCacheFactoryMetrics
 		for {
 			factoryMetrics := f.collectMetrics()
+			// idle caches are stopped and removed, so are their metrics
+			for gvk := range previous.gvks {
+				if _, ok := factoryMetrics.gvks[gvk]; !ok {
+					metrics.DelTotalCachedObjects(contextID, gvk)
+					metrics.DelCachedBytes(contextID, gvk)
+				}
+			}
 			f.recordMetricsForContext(factoryMetrics, contextID)
+			previous = factoryMetrics
 
 			timer.Reset(f.metricsCollectionPeriod)
 			select {
@@ -55,13 +133,19 @@ func (f *sharedCacheFactory) startMetricsCollection(ctx context.Context) {
 }
 
 func (f *sharedCacheFactory) recordMetricsForContext(fm sharedCacheFactoryMetrics, contextID string) {
-	for gvk, count := range fm.gvks {
-		metrics.IncTotalCachedObjects(contextID, gvk, count)
+	for gvk, stats := range fm.gvks {
+		metrics.IncTotalCachedObjects(contextID, gvk, stats.Objects)
+		metrics.SetCachedBytes(contextID, gvk, stats.ApproximateBytes)
+	}
+	for _, state := range []string{informersActive, informersIdle} {
+		metrics.SetCacheInformers(contextID, state, fm.informers[state])
 	}
 }
 
 func (f *sharedCacheFactory) cleanupMetricsForContext(fm sharedCacheFactoryMetrics, contextID string) {
 	for gvk := range fm.gvks {
 		metrics.DelTotalCachedObjects(contextID, gvk)
+		metrics.DelCachedBytes(contextID, gvk)
 	}
+	metrics.DelCacheInformers(contextID)
 }
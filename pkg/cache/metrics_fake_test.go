@@ -0,0 +1,25 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFactoryCacheStats(t *testing.T) {
+	_, caches, ctx := newTestCacheFactory(t, nil,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default"}},
+	)
+	startCache(t, ctx, caches, configMapGVK)
+
+	reporter, ok := caches.(cache.StatsReporter)
+	require.True(t, ok)
+	stats := reporter.CacheStats()[configMapGVK]
+	assert.Equal(t, 2, stats.Objects)
+	assert.Positive(t, stats.ApproximateBytes)
+}
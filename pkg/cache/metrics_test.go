@@ -1,16 +1,19 @@
-//go:generate mockgen --build_flags=--mod=mod -package cache -destination ./mocks_test.go github.com/rancher/lasso/pkg/client SharedClientFactory
+//go:generate mockgen --build_flags=--mod=mod -package cache -destination ./mocks_test.go github.com/rancher/lasso/pkg/client SharedClientFactory,ProbingClientFactory
 package cache
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
 	"github.com/rancher/lasso/pkg/client"
 	"github.com/rancher/lasso/pkg/metrics"
+	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -18,6 +21,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
 )
 
 func setupMockSharedClientFactory(t *testing.T, cf *MockSharedClientFactory, gvr schema.GroupVersionResource, gvk schema.GroupVersionKind) {
@@ -80,16 +84,28 @@ func Test_sharedCacheFactory_metrics_collection(t *testing.T) {
 	// It will report 0 items for every kind, since indexers is registered but not started, which is enough for testing
 	reg := prometheus.NewPedanticRegistry()
 	metrics.MustRegister(reg)
+	// other tests of the package leave counters in the global metrics, so the series of this factory are compared
+	// while it runs and everything must be back to the state before it started once it stopped
+	factorySeries := []string{"lasso_controller_cache_informers", "lasso_controller_cached_object_bytes", "lasso_controller_total_cached_object"}
+	before := gatherText(t, reg)
 	scf.startMetricsCollection(ctx)
 	time.Sleep(sleepPeriod)
 
 	// 1. Check initial count for registered kinds is 0
 	if err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP lasso_controller_cache_informers Number of running caches by state
+# TYPE lasso_controller_cache_informers gauge
+lasso_controller_cache_informers{ctx="test-ctx",state="active"} 0
+lasso_controller_cache_informers{ctx="test-ctx",state="idle"} 0
+# HELP lasso_controller_cached_object_bytes Approximate size of the cached objects in bytes
+# TYPE lasso_controller_cached_object_bytes gauge
+lasso_controller_cached_object_bytes{ctx="test-ctx",group="",kind="ConfigMap",version="v1"} 0
+lasso_controller_cached_object_bytes{ctx="test-ctx",group="rbac.authorization.k8s.io",kind="Role",version="v1"} 0
 # HELP lasso_controller_total_cached_object Total count of cached objects
 # TYPE lasso_controller_total_cached_object gauge
 lasso_controller_total_cached_object{ctx="test-ctx",group="",kind="ConfigMap",version="v1"} 0
 lasso_controller_total_cached_object{ctx="test-ctx",group="rbac.authorization.k8s.io",kind="Role",version="v1"} 0
-`)); err != nil {
+`), factorySeries...); err != nil {
 		t.Fatal(err)
 	}
 
@@ -101,11 +117,19 @@ lasso_controller_total_cached_object{ctx="test-ctx",group="rbac.authorization.k8
 	time.Sleep(sleepPeriod)
 
 	if err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP lasso_controller_cache_informers Number of running caches by state
+# TYPE lasso_controller_cache_informers gauge
+lasso_controller_cache_informers{ctx="test-ctx",state="active"} 0
+lasso_controller_cache_informers{ctx="test-ctx",state="idle"} 0
+# HELP lasso_controller_cached_object_bytes Approximate size of the cached objects in bytes
+# TYPE lasso_controller_cached_object_bytes gauge
+lasso_controller_cached_object_bytes{ctx="test-ctx",group="",kind="ConfigMap",version="v1"} 28
+lasso_controller_cached_object_bytes{ctx="test-ctx",group="rbac.authorization.k8s.io",kind="Role",version="v1"} 0
 # HELP lasso_controller_total_cached_object Total count of cached objects
 # TYPE lasso_controller_total_cached_object gauge
 lasso_controller_total_cached_object{ctx="test-ctx",group="",kind="ConfigMap",version="v1"} 1
 lasso_controller_total_cached_object{ctx="test-ctx",group="rbac.authorization.k8s.io",kind="Role",version="v1"} 0
-`)); err != nil {
+`), factorySeries...); err != nil {
 		t.Fatal(err)
 	}
 
@@ -116,11 +140,19 @@ lasso_controller_total_cached_object{ctx="test-ctx",group="rbac.authorization.k8
 	time.Sleep(sleepPeriod)
 
 	if err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP lasso_controller_cache_informers Number of running caches by state
+# TYPE lasso_controller_cache_informers gauge
+lasso_controller_cache_informers{ctx="test-ctx",state="active"} 0
+lasso_controller_cache_informers{ctx="test-ctx",state="idle"} 0
+# HELP lasso_controller_cached_object_bytes Approximate size of the cached objects in bytes
+# TYPE lasso_controller_cached_object_bytes gauge
+lasso_controller_cached_object_bytes{ctx="test-ctx",group="",kind="ConfigMap",version="v1"} 0
+lasso_controller_cached_object_bytes{ctx="test-ctx",group="rbac.authorization.k8s.io",kind="Role",version="v1"} 0
 # HELP lasso_controller_total_cached_object Total count of cached objects
 # TYPE lasso_controller_total_cached_object gauge
 lasso_controller_total_cached_object{ctx="test-ctx",group="",kind="ConfigMap",version="v1"} 0
 lasso_controller_total_cached_object{ctx="test-ctx",group="rbac.authorization.k8s.io",kind="Role",version="v1"} 0
-`)); err != nil {
+`), factorySeries...); err != nil {
 		t.Fatal(err)
 	}
 
@@ -128,7 +160,68 @@ lasso_controller_total_cached_object{ctx="test-ctx",group="rbac.authorization.k8
 	cancel()
 	time.Sleep(sleepPeriod)
 
-	if err := testutil.GatherAndCompare(reg, strings.NewReader("")); err != nil {
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(before)); err != nil {
 		t.Fatal(err)
 	}
 }
+
+// gatherText returns the metrics of the registry in the text format.
+func gatherText(t *testing.T, reg prometheus.Gatherer) string {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(&buf, family); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+func Test_sharedCacheFactory_informers_metrics(t *testing.T) {
+	cf := NewMockSharedClientFactory(gomock.NewController(t))
+	setupMockSharedClientFactory(t, cf, corev1.SchemeGroupVersion.WithResource("configmaps"), corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	setupMockSharedClientFactory(t, cf, rbacv1.SchemeGroupVersion.WithResource("roles"), rbacv1.SchemeGroupVersion.WithKind("Role"))
+
+	scf := NewSharedCachedFactory(cf, &SharedCacheFactoryOptions{IdleTimeout: time.Hour}).(*sharedCacheFactory)
+	if _, err := scf.ForKind(corev1.SchemeGroupVersion.WithKind("ConfigMap")); err != nil {
+		t.Fatal(err)
+	}
+	_, release, err := scf.Acquire(rbacv1.SchemeGroupVersion.WithKind("Role"), Scope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mark the caches as started without running them
+	for key := range scf.caches {
+		scf.startedCaches[key] = true
+	}
+
+	fm := scf.collectMetrics()
+	assert.Equal(t, map[string]int{informersActive: 2}, fm.informers)
+
+	release()
+	fm = scf.collectMetrics()
+	assert.Equal(t, map[string]int{informersActive: 1, informersIdle: 1}, fm.informers)
+}
+
+func Test_storeStats(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	assert.Equal(t, CacheStats{}, storeStats(store))
+
+	var size int
+	for i := 0; i < 2*cacheSizeSamples; i++ {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("cm-%d", i), Namespace: "default"}}
+		size += cm.Size()
+		if err := store.Add(cm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := storeStats(store)
+	assert.Equal(t, 2*cacheSizeSamples, stats.Objects)
+	// names differ in length, so the sample estimates the size
+	assert.InDelta(t, size, stats.ApproximateBytes, float64(size)/10)
+}
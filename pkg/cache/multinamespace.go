@@ -0,0 +1,571 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rancher/lasso/pkg/client"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+)
+
+// MultiNamespaceInformer is a SharedIndexInformer for a set of namespaces. It runs one list and watch per namespace
+// and serves the objects of all of them through its store, indexer and event handlers. Namespaces can be added and
+// removed while it runs.
+type MultiNamespaceInformer interface {
+	cache.SharedIndexInformer
+
+	// AddNamespace caches the namespace, its list and watch start right away if the informer is running.
+	AddNamespace(namespace string)
+	// RemoveNamespace stops caching the namespace. The event handlers receive a delete for each of its objects.
+	RemoveNamespace(namespace string)
+	// Namespaces returns the cached namespaces.
+	Namespaces() []string
+}
+
+// NewMultiNamespaceCache returns a MultiNamespaceInformer for the given namespaces, each namespace is cached by a
+// cache created with NewCache and opts. opts.Namespace is ignored.
+func NewMultiNamespaceCache(obj, listObj runtime.Object, client *client.Client, opts *Options, namespaces ...string) MultiNamespaceInformer {
+	m := &multiNamespaceInformer{
+		newInformer: func(namespace string) cache.SharedIndexInformer {
+			var nsOpts Options
+			if opts != nil {
+				nsOpts = *opts
+			}
+			nsOpts.Namespace = namespace
+			// snapshots are kept per GroupVersionKind and can not be shared by the namespaces
+			nsOpts.snapshots = nil
+			return NewCache(obj, listObj, client, &nsOpts)
+		},
+		informers: map[string]*namespaceInformer{},
+	}
+	for _, namespace := range namespaces {
+		m.AddNamespace(namespace)
+	}
+	return m
+}
+
+type namespaceInformer struct {
+	cache.SharedIndexInformer
+	stop          chan struct{}
+	registrations map[*multiNamespaceRegistration]cache.ResourceEventHandlerRegistration
+}
+
+type multiNamespaceInformer struct {
+	newInformer func(namespace string) cache.SharedIndexInformer
+
+	lock              sync.RWMutex
+	informers         map[string]*namespaceInformer
+	handlers          []*multiNamespaceRegistration
+	indexers          cache.Indexers
+	transform         cache.TransformFunc
+	watchErrorHandler cache.WatchErrorHandler
+	stopCh            <-chan struct{}
+	started           bool
+	stopped           bool
+}
+
+// multiNamespaceRegistration is the registration of an event handler with the informers of all namespaces.
+type multiNamespaceRegistration struct {
+	informer  *multiNamespaceInformer
+	handler   cache.ResourceEventHandler
+	resync    time.Duration
+	hasResync bool
+}
+
+func (r *multiNamespaceRegistration) HasSynced() bool {
+	r.informer.lock.RLock()
+	defer r.informer.lock.RUnlock()
+
+	for _, informer := range r.informer.informers {
+		if registration, ok := informer.registrations[r]; !ok || !registration.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *multiNamespaceInformer) AddNamespace(namespace string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.informers[namespace]; ok {
+		return
+	}
+
+	informer := &namespaceInformer{
+		SharedIndexInformer: m.newInformer(namespace),
+		stop:                make(chan struct{}),
+		registrations:       map[*multiNamespaceRegistration]cache.ResourceEventHandlerRegistration{},
+	}
+	// the informer was just created, so these can only fail for invalid indexers, which failed for the other
+	// namespaces already
+	if m.indexers != nil {
+		_ = informer.AddIndexers(m.indexers)
+	}
+	if m.transform != nil {
+		_ = informer.SetTransform(m.transform)
+	}
+	if m.watchErrorHandler != nil {
+		_ = informer.SetWatchErrorHandler(m.watchErrorHandler)
+	}
+	for _, handler := range m.handlers {
+		if registration, err := handler.addTo(informer); err == nil {
+			informer.registrations[handler] = registration
+		}
+	}
+
+	m.informers[namespace] = informer
+	if m.started && !m.stopped {
+		m.run(informer)
+	}
+}
+
+func (m *multiNamespaceInformer) RemoveNamespace(namespace string) {
+	m.lock.Lock()
+	informer, ok := m.informers[namespace]
+	if !ok {
+		m.lock.Unlock()
+		return
+	}
+	delete(m.informers, namespace)
+	close(informer.stop)
+	handlers := m.handlers
+	m.lock.Unlock()
+
+	objs := informer.GetStore().List()
+	for _, handler := range handlers {
+		if registration, ok := informer.registrations[handler]; ok {
+			_ = informer.RemoveEventHandler(registration)
+		}
+		for _, obj := range objs {
+			handler.handler.OnDelete(obj)
+		}
+	}
+}
+
+func (m *multiNamespaceInformer) Namespaces() []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	namespaces := make([]string, 0, len(m.informers))
+	for namespace := range m.informers {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// run starts the informer of a namespace, the caller must hold m.lock.
+func (m *multiNamespaceInformer) run(informer *namespaceInformer) {
+	go informer.Run(mergeStop(m.stopCh, informer.stop))
+}
+
+// mergeStop returns a channel that is closed once a or b is closed.
+func mergeStop(a, b <-chan struct{}) <-chan struct{} {
+	stop := make(chan struct{})
+	go func() {
+		defer close(stop)
+		select {
+		case <-a:
+		case <-b:
+		}
+	}()
+	return stop
+}
+
+func (m *multiNamespaceInformer) Run(stopCh <-chan struct{}) {
+	m.lock.Lock()
+	if m.started {
+		m.lock.Unlock()
+		return
+	}
+	m.started = true
+	m.stopCh = stopCh
+	for _, informer := range m.informers {
+		m.run(informer)
+	}
+	m.lock.Unlock()
+
+	<-stopCh
+
+	m.lock.Lock()
+	m.stopped = true
+	m.lock.Unlock()
+}
+
+func (m *multiNamespaceInformer) AddEventHandler(handler cache.ResourceEventHandler) (cache.ResourceEventHandlerRegistration, error) {
+	return m.addEventHandler(&multiNamespaceRegistration{
+		informer: m,
+		handler:  handler,
+	})
+}
+
+func (m *multiNamespaceInformer) AddEventHandlerWithResyncPeriod(handler cache.ResourceEventHandler, resyncPeriod time.Duration) (cache.ResourceEventHandlerRegistration, error) {
+	return m.addEventHandler(&multiNamespaceRegistration{
+		informer:  m,
+		handler:   handler,
+		resync:    resyncPeriod,
+		hasResync: true,
+	})
+}
+
+func (r *multiNamespaceRegistration) addTo(informer cache.SharedIndexInformer) (cache.ResourceEventHandlerRegistration, error) {
+	if r.hasResync {
+		return informer.AddEventHandlerWithResyncPeriod(r.handler, r.resync)
+	}
+	return informer.AddEventHandler(r.handler)
+}
+
+func (m *multiNamespaceInformer) addEventHandler(handler *multiNamespaceRegistration) (cache.ResourceEventHandlerRegistration, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.stopped {
+		return nil, errors.New("handler was not added to shared informer because it has stopped already")
+	}
+
+	for _, informer := range m.informers {
+		registration, err := handler.addTo(informer)
+		if err != nil {
+			return nil, err
+		}
+		informer.registrations[handler] = registration
+	}
+	m.handlers = append(m.handlers, handler)
+	return handler, nil
+}
+
+func (m *multiNamespaceInformer) RemoveEventHandler(handle cache.ResourceEventHandlerRegistration) error {
+	handler, ok := handle.(*multiNamespaceRegistration)
+	if !ok {
+		return fmt.Errorf("unexpected event handler registration %T", handle)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, informer := range m.informers {
+		if registration, ok := informer.registrations[handler]; ok {
+			if err := informer.RemoveEventHandler(registration); err != nil {
+				return err
+			}
+			delete(informer.registrations, handler)
+		}
+	}
+	for i, h := range m.handlers {
+		if h == handler {
+			m.handlers = append(m.handlers[:i:i], m.handlers[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *multiNamespaceInformer) GetStore() cache.Store {
+	return &multiNamespaceIndexer{informer: m}
+}
+
+func (m *multiNamespaceInformer) GetIndexer() cache.Indexer {
+	return &multiNamespaceIndexer{informer: m}
+}
+
+func (m *multiNamespaceInformer) GetController() cache.Controller {
+	return &multiNamespaceController{informer: m}
+}
+
+func (m *multiNamespaceInformer) HasSynced() bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if !m.started {
+		return false
+	}
+	for _, informer := range m.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// LastSyncResourceVersion returns an empty string, the namespaces are synced to different resourceVersions.
+func (m *multiNamespaceInformer) LastSyncResourceVersion() string {
+	return ""
+}
+
+func (m *multiNamespaceInformer) SetWatchErrorHandler(handler cache.WatchErrorHandler) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.started {
+		return errors.New("informer has already started")
+	}
+	for _, informer := range m.informers {
+		if err := informer.SetWatchErrorHandler(handler); err != nil {
+			return err
+		}
+	}
+	m.watchErrorHandler = handler
+	return nil
+}
+
+func (m *multiNamespaceInformer) SetTransform(handler cache.TransformFunc) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.started {
+		return errors.New("informer has already started")
+	}
+	for _, informer := range m.informers {
+		if err := informer.SetTransform(handler); err != nil {
+			return err
+		}
+	}
+	m.transform = handler
+	return nil
+}
+
+func (m *multiNamespaceInformer) IsStopped() bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.stopped
+}
+
+func (m *multiNamespaceInformer) AddIndexers(indexers cache.Indexers) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.stopped {
+		return errors.New("indexer was not added because it has stopped already")
+	}
+	caller := callerPackage(0)
+	for _, informer := range m.informers {
+		d, ok := informer.SharedIndexInformer.(*deferredCache)
+		if !ok {
+			if err := informer.AddIndexers(indexers); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.addIndexers(indexers, caller); err != nil {
+			return err
+		}
+	}
+	if m.indexers == nil {
+		m.indexers = cache.Indexers{}
+	}
+	for name, indexFunc := range indexers {
+		m.indexers[name] = indexFunc
+	}
+	return nil
+}
+
+// namespaceIndexers returns the indexers of the cached namespaces.
+func (m *multiNamespaceInformer) namespaceIndexers() []cache.Indexer {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	indexers := make([]cache.Indexer, 0, len(m.informers))
+	for _, informer := range m.informers {
+		indexers = append(indexers, informer.GetIndexer())
+	}
+	return indexers
+}
+
+func (m *multiNamespaceInformer) namespaceIndexer(namespace string) (cache.Indexer, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	informer, ok := m.informers[namespace]
+	if !ok {
+		return nil, false
+	}
+	return informer.GetIndexer(), true
+}
+
+type multiNamespaceController struct {
+	informer *multiNamespaceInformer
+}
+
+// Run does nothing, like the controller of a SharedIndexInformer, the informer is run with its own Run.
+func (c *multiNamespaceController) Run(<-chan struct{}) {}
+
+func (c *multiNamespaceController) HasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+func (c *multiNamespaceController) LastSyncResourceVersion() string {
+	return c.informer.LastSyncResourceVersion()
+}
+
+// multiNamespaceIndexer serves the objects of all namespaces of a multiNamespaceInformer. Reads are merged from
+// the indexers of the namespaces, writes go to the indexer of the object's namespace.
+type multiNamespaceIndexer struct {
+	informer *multiNamespaceInformer
+}
+
+func (m *multiNamespaceIndexer) indexerFor(obj interface{}) (cache.Indexer, error) {
+	namespace, err := objectNamespace(obj)
+	if err != nil {
+		return nil, err
+	}
+	indexer, ok := m.informer.namespaceIndexer(namespace)
+	if !ok {
+		return nil, fmt.Errorf("namespace %q is not cached", namespace)
+	}
+	return indexer, nil
+}
+
+func objectNamespace(obj interface{}) (string, error) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		namespace, _, err := cache.SplitMetaNamespaceKey(tombstone.Key)
+		return namespace, err
+	}
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return "", err
+	}
+	return m.GetNamespace(), nil
+}
+
+func (m *multiNamespaceIndexer) Add(obj interface{}) error {
+	indexer, err := m.indexerFor(obj)
+	if err != nil {
+		return err
+	}
+	return indexer.Add(obj)
+}
+
+func (m *multiNamespaceIndexer) Update(obj interface{}) error {
+	indexer, err := m.indexerFor(obj)
+	if err != nil {
+		return err
+	}
+	return indexer.Update(obj)
+}
+
+func (m *multiNamespaceIndexer) Delete(obj interface{}) error {
+	indexer, err := m.indexerFor(obj)
+	if err != nil {
+		return err
+	}
+	return indexer.Delete(obj)
+}
+
+func (m *multiNamespaceIndexer) List() []interface{} {
+	var result []interface{}
+	for _, indexer := range m.informer.namespaceIndexers() {
+		result = append(result, indexer.List()...)
+	}
+	return result
+}
+
+func (m *multiNamespaceIndexer) ListKeys() []string {
+	var result []string
+	for _, indexer := range m.informer.namespaceIndexers() {
+		result = append(result, indexer.ListKeys()...)
+	}
+	return result
+}
+
+func (m *multiNamespaceIndexer) Get(obj interface{}) (interface{}, bool, error) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return nil, false, err
+	}
+	return m.GetByKey(key)
+}
+
+func (m *multiNamespaceIndexer) GetByKey(key string) (interface{}, bool, error) {
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	indexer, ok := m.informer.namespaceIndexer(namespace)
+	if !ok {
+		return nil, false, nil
+	}
+	return indexer.GetByKey(key)
+}
+
+func (m *multiNamespaceIndexer) Replace([]interface{}, string) error {
+	return errors.New("replace is not supported by multi-namespace caches")
+}
+
+func (m *multiNamespaceIndexer) Resync() error {
+	for _, indexer := range m.informer.namespaceIndexers() {
+		if err := indexer.Resync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *multiNamespaceIndexer) Index(indexName string, obj interface{}) ([]interface{}, error) {
+	var result []interface{}
+	for _, indexer := range m.informer.namespaceIndexers() {
+		objs, err := indexer.Index(indexName, obj)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, objs...)
+	}
+	return result, nil
+}
+
+func (m *multiNamespaceIndexer) IndexKeys(indexName, indexedValue string) ([]string, error) {
+	var result []string
+	for _, indexer := range m.informer.namespaceIndexers() {
+		keys, err := indexer.IndexKeys(indexName, indexedValue)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, keys...)
+	}
+	return result, nil
+}
+
+func (m *multiNamespaceIndexer) ListIndexFuncValues(indexName string) []string {
+	values := sets.New[string]()
+	for _, indexer := range m.informer.namespaceIndexers() {
+		values.Insert(indexer.ListIndexFuncValues(indexName)...)
+	}
+	return sets.List(values)
+}
+
+func (m *multiNamespaceIndexer) ByIndex(indexName, indexedValue string) ([]interface{}, error) {
+	var result []interface{}
+	for _, indexer := range m.informer.namespaceIndexers() {
+		objs, err := indexer.ByIndex(indexName, indexedValue)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, objs...)
+	}
+	return result, nil
+}
+
+func (m *multiNamespaceIndexer) GetIndexers() cache.Indexers {
+	result := cache.Indexers{}
+	for _, indexer := range m.informer.namespaceIndexers() {
+		for name, indexFunc := range indexer.GetIndexers() {
+			result[name] = indexFunc
+		}
+	}
+	m.informer.lock.RLock()
+	defer m.informer.lock.RUnlock()
+	for name, indexFunc := range m.informer.indexers {
+		result[name] = indexFunc
+	}
+	return result
+}
+
+func (m *multiNamespaceIndexer) AddIndexers(indexers cache.Indexers) error {
+	return m.informer.AddIndexers(indexers)
+}
@@ -0,0 +1,75 @@
+package cache_test
+
+import (
+	"maps"
+	"sync"
+	"testing"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgocache "k8s.io/client-go/tools/cache"
+)
+
+func TestFactoryMultiNamespaceCache(t *testing.T) {
+	_, caches, ctx := newTestCacheFactory(t, &cache.SharedCacheFactoryOptions{
+		KindNamespaces: map[schema.GroupVersionKind][]string{
+			configMapGVK: {"a", "b"},
+		},
+	},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "a"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "b"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "c"}},
+	)
+
+	var (
+		lock   sync.Mutex
+		cached = map[string]bool{}
+	)
+	record := func(obj interface{}, exists bool) {
+		key, err := clientgocache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		require.NoError(t, err)
+		lock.Lock()
+		defer lock.Unlock()
+		cached[key] = exists
+	}
+	cachedKeys := func() map[string]bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return maps.Clone(cached)
+	}
+
+	informer, err := caches.ForKind(configMapGVK)
+	require.NoError(t, err)
+	_, err = informer.AddEventHandler(clientgocache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { record(obj, true) },
+		UpdateFunc: func(_, obj interface{}) { record(obj, true) },
+		DeleteFunc: func(obj interface{}) { record(obj, false) },
+	})
+	require.NoError(t, err)
+	startCache(t, ctx, caches, configMapGVK)
+
+	eventually(t, func() bool {
+		return assert.ObjectsAreEqual(map[string]bool{"a/cm": true, "b/cm": true}, cachedKeys())
+	})
+	assert.ElementsMatch(t, []string{"a/cm", "b/cm"}, informer.GetStore().ListKeys())
+
+	namespaces, ok := informer.(cache.MultiNamespaceInformer)
+	require.True(t, ok)
+	namespaces.AddNamespace("c")
+	namespaces.RemoveNamespace("a")
+	assert.Equal(t, []string{"b", "c"}, namespaces.Namespaces())
+
+	// objects of removed namespaces are deleted from the cache
+	eventually(t, func() bool {
+		return assert.ObjectsAreEqual(map[string]bool{"a/cm": false, "b/cm": true, "c/cm": true}, cachedKeys())
+	})
+	assert.ElementsMatch(t, []string{"b/cm", "c/cm"}, informer.GetStore().ListKeys())
+
+	byNamespace, err := informer.GetIndexer().ByIndex(clientgocache.NamespaceIndex, "c")
+	require.NoError(t, err)
+	assert.Len(t, byNamespace, 1)
+}
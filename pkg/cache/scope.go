@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ScopedCacheFactory is implemented by the SharedCacheFactory returned by NewSharedCachedFactory.
+type ScopedCacheFactory interface {
+	// ForKindScope returns the cache of the kind restricted to the scope. Caches are shared by everyone asking
+	// for the same kind and scope, StartGVK starts all caches of a kind.
+	ForKindScope(gvk schema.GroupVersionKind, scope Scope) (cache.SharedIndexInformer, error)
+	ForResourceKindScope(gvr schema.GroupVersionResource, kind string, namespaced bool, scope Scope) (cache.SharedIndexInformer, error)
+}
+
+// ForKindScope returns the cache of the kind restricted to the scope, see ScopedCacheFactory. Factories without
+// scoped caches only return the cache of the zero Scope.
+func ForKindScope(factory SharedCacheFactory, gvk schema.GroupVersionKind, scope Scope) (cache.SharedIndexInformer, error) {
+	if scoped, ok := factory.(ScopedCacheFactory); ok {
+		return scoped.ForKindScope(gvk, scope)
+	}
+	if err := unscoped(factory, scope); err != nil {
+		return nil, err
+	}
+	return factory.ForKind(gvk)
+}
+
+// ForResourceKindScope is ForKindScope for a resource whose kind may differ from the scheme's.
+func ForResourceKindScope(factory SharedCacheFactory, gvr schema.GroupVersionResource, kind string, namespaced bool, scope Scope) (cache.SharedIndexInformer, error) {
+	if scoped, ok := factory.(ScopedCacheFactory); ok {
+		return scoped.ForResourceKindScope(gvr, kind, namespaced, scope)
+	}
+	if err := unscoped(factory, scope); err != nil {
+		return nil, err
+	}
+	return factory.ForResourceKind(gvr, kind, namespaced)
+}
+
+func unscoped(factory SharedCacheFactory, scope Scope) error {
+	if scope != (Scope{}) {
+		return fmt.Errorf("%T does not support scoped caches, cannot restrict a cache to %s", factory, scope)
+	}
+	return nil
+}
+
+// Scope restricts a cache to a namespace and to the objects matching label and field selectors. The zero Scope
+// is the cache of the factory's options for the kind.
+type Scope struct {
+	// Namespace overrides the namespace of the kind's options.
+	Namespace string
+	// LabelSelector and FieldSelector are combined with the selectors set by the kind's TweakList.
+	LabelSelector string
+	FieldSelector string
+}
+
+func (s Scope) String() string {
+	var parts []string
+	if s.Namespace != "" {
+		parts = append(parts, "namespace="+s.Namespace)
+	}
+	if s.LabelSelector != "" {
+		parts = append(parts, "labels="+s.LabelSelector)
+	}
+	if s.FieldSelector != "" {
+		parts = append(parts, "fields="+s.FieldSelector)
+	}
+	return strings.Join(parts, ";")
+}
+
+func (s Scope) tweakList(tweakList TweakListOptionsFunc) TweakListOptionsFunc {
+	return func(options *v1.ListOptions) {
+		if tweakList != nil {
+			tweakList(options)
+		}
+		options.LabelSelector = joinSelectors(options.LabelSelector, s.LabelSelector)
+		options.FieldSelector = joinSelectors(options.FieldSelector, s.FieldSelector)
+	}
+}
+
+// joinSelectors combines two selectors, the requirements of selectors separated by commas must all match.
+func joinSelectors(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + "," + b
+}
+
+// cacheKey identifies the caches of a factory, unscoped caches have the zero Scope.
+type cacheKey struct {
+	gvk   schema.GroupVersionKind
+	scope Scope
+}
+
+func (k cacheKey) String() string {
+	if k.scope == (Scope{}) {
+		return k.gvk.String()
+	}
+	return k.gvk.String() + "[" + k.scope.String() + "]"
+}
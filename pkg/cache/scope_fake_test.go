@@ -0,0 +1,49 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgocache "k8s.io/client-go/tools/cache"
+)
+
+func TestFactoryScopedCaches(t *testing.T) {
+	_, caches, ctx := newTestCacheFactory(t, nil,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "blue", Namespace: "a", Labels: map[string]string{"color": "blue"}}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "red", Namespace: "a", Labels: map[string]string{"color": "red"}}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "blue", Namespace: "b", Labels: map[string]string{"color": "blue"}}},
+	)
+	blue := cache.Scope{LabelSelector: "color=blue"}
+	red := cache.Scope{Namespace: "a", LabelSelector: "color=red"}
+
+	blueCache, err := cache.ForKindScope(caches, configMapGVK, blue)
+	require.NoError(t, err)
+	redCache, err := cache.ForKindScope(caches, configMapGVK, red)
+	require.NoError(t, err)
+	assert.NotSame(t, blueCache, redCache)
+
+	sameCache, err := cache.ForKindScope(caches, configMapGVK, cache.Scope{LabelSelector: "color=blue"})
+	require.NoError(t, err)
+	assert.Same(t, blueCache, sameCache)
+
+	// StartGVK starts every cache of the kind
+	startCache(t, ctx, caches, configMapGVK)
+	require.True(t, clientgocache.WaitForCacheSync(ctx.Done(), blueCache.HasSynced, redCache.HasSynced))
+	assert.ElementsMatch(t, []string{"a/blue", "b/blue"}, blueCache.GetStore().ListKeys())
+	assert.Equal(t, []string{"a/red"}, redCache.GetStore().ListKeys())
+	assert.True(t, caches.(cache.SyncReporter).HasSynced()[configMapGVK])
+
+	// factories without scoped caches only have the cache of the zero Scope
+	unscoped := struct{ cache.SharedCacheFactory }{caches}
+	_, err = cache.ForKindScope(unscoped, configMapGVK, blue)
+	assert.ErrorContains(t, err, "does not support scoped caches")
+	informer, err := cache.ForKindScope(unscoped, configMapGVK, cache.Scope{})
+	require.NoError(t, err)
+	pinned, err := caches.ForKind(configMapGVK)
+	require.NoError(t, err)
+	assert.Same(t, pinned, informer)
+}
@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestScopeTweakList(t *testing.T) {
+	scope := Scope{Namespace: "a", LabelSelector: "color=blue"}
+	assert.Equal(t, "namespace=a;labels=color=blue", scope.String())
+
+	options := metav1.ListOptions{}
+	scope.tweakList(func(options *metav1.ListOptions) {
+		options.LabelSelector = "app=web"
+		options.FieldSelector = "metadata.name=cm"
+	})(&options)
+	assert.Equal(t, "app=web,color=blue", options.LabelSelector)
+	assert.Equal(t, "metadata.name=cm", options.FieldSelector)
+
+	options = metav1.ListOptions{}
+	scope.tweakList(nil)(&options)
+	assert.Equal(t, "color=blue", options.LabelSelector)
+}
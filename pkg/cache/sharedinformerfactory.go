@@ -6,24 +6,116 @@ import (
 	"time"
 
 	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/log"
 	"github.com/rancher/lasso/pkg/metrics"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
 )
 
 type TweakListOptionsFunc func(*v1.ListOptions)
 
+// ReleaseFunc drops the reference on a cache taken with Acquire, calling it more than once has no effect.
+type ReleaseFunc func()
+
+// AcquiringCacheFactory is implemented by the SharedCacheFactory returned by NewSharedCachedFactory.
+type AcquiringCacheFactory interface {
+	// Acquire returns the cache of the kind and scope and takes a reference on it. Unlike the caches returned by
+	// ForKind, which run until the context of Start is cancelled, the cache is stopped and removed IdleTimeout
+	// after its last reference was released, a later Acquire creates a new cache. Start the cache with StartGVK.
+	Acquire(gvk schema.GroupVersionKind, scope Scope) (cache.SharedIndexInformer, ReleaseFunc, error)
+	AcquireResourceKind(gvr schema.GroupVersionResource, kind string, namespaced bool, scope Scope) (cache.SharedIndexInformer, ReleaseFunc, error)
+}
+
+// Acquire takes a reference on the cache of the kind and scope, see AcquiringCacheFactory. Factories that do not
+// stop idle caches return the cache of ForKindScope, which runs until the factory is stopped, and a ReleaseFunc
+// without effect.
+func Acquire(factory SharedCacheFactory, gvk schema.GroupVersionKind, scope Scope) (cache.SharedIndexInformer, ReleaseFunc, error) {
+	if acquiring, ok := factory.(AcquiringCacheFactory); ok {
+		return acquiring.Acquire(gvk, scope)
+	}
+	return pinned(ForKindScope(factory, gvk, scope))
+}
+
+// AcquireResourceKind is Acquire for a resource whose kind may differ from the scheme's.
+func AcquireResourceKind(factory SharedCacheFactory, gvr schema.GroupVersionResource, kind string, namespaced bool, scope Scope) (cache.SharedIndexInformer, ReleaseFunc, error) {
+	if acquiring, ok := factory.(AcquiringCacheFactory); ok {
+		return acquiring.AcquireResourceKind(gvr, kind, namespaced, scope)
+	}
+	return pinned(ForResourceKindScope(factory, gvr, kind, namespaced, scope))
+}
+
+func pinned(informer cache.SharedIndexInformer, err error) (cache.SharedIndexInformer, ReleaseFunc, error) {
+	if err != nil {
+		return nil, nil, err
+	}
+	return informer, func() {}, nil
+}
+
+const defaultIdleTimeout = time.Minute
+
 type SharedCacheFactoryOptions struct {
 	DefaultResync    time.Duration
 	DefaultNamespace string
 	DefaultTweakList TweakListOptionsFunc
-
-	KindResync     map[schema.GroupVersionKind]time.Duration
-	KindNamespace  map[schema.GroupVersionKind]string
+	// DefaultTransform is applied to objects before they are cached, for example StripMetadata.
+	DefaultTransform cache.TransformFunc
+	// DefaultWatchList makes the caches list with the streaming list protocol, see Options.WatchList.
+	DefaultWatchList bool
+	// DefaultIndexers are added to every cache when it is created, together with the KindIndexers of its kind.
+	// Registering indexers here avoids depending on the order in which packages get and start the caches,
+	// indexers added to a started cache have to index every cached object and conflict with indexers of the same
+	// name. See OwnerUIDIndexFunc, ControllerOwnerIndexFunc, LabelIndexFunc and FieldPathIndexFunc for common
+	// indexers.
+	DefaultIndexers cache.Indexers
+	// DefaultHooks are notified about the lists and watches of every cache, KindHooks replace them per kind. The
+	// lists, watch restarts and watch errors of the caches are counted in metrics regardless.
+	DefaultHooks Hooks
+
+	KindResync    map[schema.GroupVersionKind]time.Duration
+	KindNamespace map[schema.GroupVersionKind]string
+	// KindNamespaces caches the kinds in the given namespaces, with a list and watch per namespace, for example
+	// where RBAC only allows access to a few namespaces. The caches are MultiNamespaceInformers, so namespaces can
+	// be added and removed later. It takes precedence over KindNamespace and DefaultNamespace, snapshots are not
+	// used for these kinds.
+	KindNamespaces map[schema.GroupVersionKind][]string
 	KindTweakList  map[schema.GroupVersionKind]TweakListOptionsFunc
+	KindTransform  map[schema.GroupVersionKind]cache.TransformFunc
+	KindWatchList  map[schema.GroupVersionKind]bool
+	KindIndexers   map[schema.GroupVersionKind]cache.Indexers
+	KindHooks      map[schema.GroupVersionKind]Hooks
+	// KindAudit audits the caches of the kinds for drift from the apiserver, which happens if watch events are
+	// lost. The audits list the metadata of the objects and report missing, extra and stale objects as metrics
+	// and logs. Caches of kinds in KindNamespaces are not audited.
+	KindAudit map[schema.GroupVersionKind]AuditOptions
+	// KindMetadataOnly caches only the metadata of the kinds as PartialObjectMetadata, which is listed and watched
+	// with the metadata Accept header. Handlers of controllers using these caches receive PartialObjectMetadata.
+	KindMetadataOnly map[schema.GroupVersionKind]bool
+	// HealthCallback is called with the result of every apiserver health probe.
 	HealthCallback func(healthy bool)
+	// HealthCheck configures the apiserver health probes.
+	HealthCheck HealthCheckOptions
+
+	// SnapshotStore enables snapshots of the caches. Caches start from their snapshot instead of listing from the
+	// apiserver and watch from the snapshot's resourceVersion, they relist if it is too old. Caches are therefore
+	// synced before they caught up with the apiserver. The caches are saved every SnapshotInterval and when they
+	// are stopped. Snapshots must only be used with the same namespace and list options they were saved with.
+	SnapshotStore    SnapshotStore
+	SnapshotInterval time.Duration
+
+	// DefaultSyncTimeout limits how long WaitForCacheSync waits for the caches of a kind, so that a kind that can
+	// not be listed does not block the others. KindSyncTimeout overrides it per kind. Defaults to no timeout.
+	DefaultSyncTimeout time.Duration
+	KindSyncTimeout    map[schema.GroupVersionKind]time.Duration
+
+	// IdleTimeout is how long a cache taken with Acquire keeps running after its last reference was released.
+	// Defaults to 1 minute.
+	IdleTimeout time.Duration
+	// Clock runs the idle timeouts. Defaults to the real clock, tests can pass a fake clock to stop idle caches
+	// without waiting.
+	Clock clock.WithDelayedExecution
 
 	// Determines how often metrics are gathered about how many resources are
 	// cached by gvk across all caches in the sharedCacheFactory
@@ -34,16 +126,42 @@ type sharedCacheFactory struct {
 	lock sync.RWMutex
 
 	tweakList           TweakListOptionsFunc
+	transform           cache.TransformFunc
 	defaultResync       time.Duration
 	defaultNamespace    string
 	customResync        map[schema.GroupVersionKind]time.Duration
 	customNamespaces    map[schema.GroupVersionKind]string
+	customNamespaceSets map[schema.GroupVersionKind][]string
 	customTweakList     map[schema.GroupVersionKind]TweakListOptionsFunc
+	customTransform     map[schema.GroupVersionKind]cache.TransformFunc
+	metadataOnly        map[schema.GroupVersionKind]bool
+	watchList           bool
+	customWatchList     map[schema.GroupVersionKind]bool
+	indexers            cache.Indexers
+	customIndexers      map[schema.GroupVersionKind]cache.Indexers
+	hooks               Hooks
+	customHooks         map[schema.GroupVersionKind]Hooks
+	customAudit         map[schema.GroupVersionKind]AuditOptions
 	sharedClientFactory client.SharedClientFactory
 	healthcheck         healthcheck
-
-	caches        map[schema.GroupVersionKind]cache.SharedIndexInformer
-	startedCaches map[schema.GroupVersionKind]bool
+	snapshotStore       SnapshotStore
+	snapshotInterval    time.Duration
+	idleTimeout         time.Duration
+	clock               clock.WithDelayedExecution
+	syncTimeout         time.Duration
+	customSyncTimeout   map[schema.GroupVersionKind]time.Duration
+
+	caches        map[cacheKey]cache.SharedIndexInformer
+	startedCaches map[cacheKey]bool
+	snapshots     map[cacheKey]*snapshotter
+	auditors      map[cacheKey]*auditor
+	syncs         map[cacheKey]*syncState
+	// caches returned by ForKind and the like are pinned and run until the factory is stopped, the others are
+	// stopped after idleTimeout once their references were released.
+	pinned     map[cacheKey]bool
+	refs       map[cacheKey]int
+	cancels    map[cacheKey]context.CancelFunc
+	idleTimers map[cacheKey]clock.Timer
 
 	metricsCollectionStarted bool
 	metricsCollectionPeriod  time.Duration
@@ -55,16 +173,41 @@ func NewSharedCachedFactory(sharedClientFactory client.SharedClientFactory, opts
 
 	factory := &sharedCacheFactory{
 		tweakList:           opts.DefaultTweakList,
+		transform:           opts.DefaultTransform,
 		defaultResync:       opts.DefaultResync,
 		defaultNamespace:    opts.DefaultNamespace,
 		customResync:        opts.KindResync,
 		customNamespaces:    opts.KindNamespace,
+		customNamespaceSets: opts.KindNamespaces,
 		customTweakList:     opts.KindTweakList,
-		caches:              map[schema.GroupVersionKind]cache.SharedIndexInformer{},
-		startedCaches:       map[schema.GroupVersionKind]bool{},
+		customTransform:     opts.KindTransform,
+		metadataOnly:        opts.KindMetadataOnly,
+		watchList:           opts.DefaultWatchList,
+		customWatchList:     opts.KindWatchList,
+		indexers:            opts.DefaultIndexers,
+		customIndexers:      opts.KindIndexers,
+		hooks:               opts.DefaultHooks,
+		customHooks:         opts.KindHooks,
+		customAudit:         opts.KindAudit,
+		caches:              map[cacheKey]cache.SharedIndexInformer{},
+		startedCaches:       map[cacheKey]bool{},
+		snapshots:           map[cacheKey]*snapshotter{},
+		auditors:            map[cacheKey]*auditor{},
+		syncs:               map[cacheKey]*syncState{},
+		pinned:              map[cacheKey]bool{},
+		refs:                map[cacheKey]int{},
+		cancels:             map[cacheKey]context.CancelFunc{},
+		idleTimers:          map[cacheKey]clock.Timer{},
+		snapshotStore:       opts.SnapshotStore,
+		snapshotInterval:    opts.SnapshotInterval,
+		idleTimeout:         opts.IdleTimeout,
+		clock:               opts.Clock,
+		syncTimeout:         opts.DefaultSyncTimeout,
+		customSyncTimeout:   opts.KindSyncTimeout,
 		sharedClientFactory: sharedClientFactory,
 		healthcheck: healthcheck{
 			callback: opts.HealthCallback,
+			opts:     applyHealthCheckDefaults(opts.HealthCheck),
 		},
 		metricsCollectionPeriod: opts.MetricsCollectionPeriod,
 	}
@@ -82,6 +225,18 @@ func applyDefaults(opts *SharedCacheFactoryOptions) *SharedCacheFactoryOptions {
 		newOpts.MetricsCollectionPeriod = defaultCacheMetricsCollectionPeriod
 	}
 
+	if newOpts.SnapshotInterval == 0 {
+		newOpts.SnapshotInterval = defaultSnapshotInterval
+	}
+
+	if newOpts.IdleTimeout == 0 {
+		newOpts.IdleTimeout = defaultIdleTimeout
+	}
+
+	if newOpts.Clock == nil {
+		newOpts.Clock = clock.RealClock{}
+	}
+
 	return &newOpts
 }
 
@@ -89,14 +244,10 @@ func (f *sharedCacheFactory) StartGVK(ctx context.Context, gvk schema.GroupVersi
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
-	informer, ok := f.caches[gvk]
-	if !ok {
-		return nil
-	}
-
-	if !f.startedCaches[gvk] {
-		go informer.Run(ctx.Done())
-		f.startedCaches[gvk] = true
+	for key, informer := range f.caches {
+		if key.gvk == gvk && !f.startedCaches[key] {
+			f.run(ctx, key, informer)
+		}
 	}
 
 	return nil
@@ -112,8 +263,7 @@ func (f *sharedCacheFactory) Start(ctx context.Context) error {
 
 	for informerType, informer := range f.caches {
 		if !f.startedCaches[informerType] {
-			go informer.Run(ctx.Done())
-			f.startedCaches[informerType] = true
+			f.run(ctx, informerType, informer)
 		}
 	}
 
@@ -125,12 +275,32 @@ func (f *sharedCacheFactory) Start(ctx context.Context) error {
 	return nil
 }
 
+// run starts the informer, the caller must hold f.lock.
+func (f *sharedCacheFactory) run(ctx context.Context, key cacheKey, informer cache.SharedIndexInformer) {
+	if snapshots := f.snapshots[key]; snapshots != nil {
+		snapshots.contextID = metrics.ContextID(ctx)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	f.cancels[key] = cancel
+	if syncs := f.syncs[key]; syncs != nil {
+		syncs.start()
+		go syncs.waitSynced(ctx, informer.HasSynced)
+	}
+	go informer.Run(ctx.Done())
+	if auditor := f.auditors[key]; auditor != nil {
+		go auditor.run(ctx)
+	}
+	f.startedCaches[key] = true
+}
+
+// WaitForCacheSync waits for the started caches, a GroupVersionKind is synced if all its caches are. The caches are
+// waited for concurrently, each up to the sync timeout of its kind.
 func (f *sharedCacheFactory) WaitForCacheSync(ctx context.Context) map[schema.GroupVersionKind]bool {
-	informers := func() map[schema.GroupVersionKind]cache.SharedIndexInformer {
+	informers := func() map[cacheKey]cache.SharedIndexInformer {
 		f.lock.Lock()
 		defer f.lock.Unlock()
 
-		informers := map[schema.GroupVersionKind]cache.SharedIndexInformer{}
+		informers := map[cacheKey]cache.SharedIndexInformer{}
 		for informerType, informer := range f.caches {
 			if f.startedCaches[informerType] {
 				informers[informerType] = informer
@@ -139,9 +309,87 @@ func (f *sharedCacheFactory) WaitForCacheSync(ctx context.Context) map[schema.Gr
 		return informers
 	}()
 
-	res := map[schema.GroupVersionKind]bool{}
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		res  = map[schema.GroupVersionKind]bool{}
+	)
 	for informType, informer := range informers {
-		res[informType] = cache.WaitForCacheSync(ctx.Done(), informer.HasSynced)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			synced := f.waitForCacheSync(ctx, informType, informer)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if previous, ok := res[informType.gvk]; ok {
+				synced = synced && previous
+			}
+			res[informType.gvk] = synced
+		}()
+	}
+	wg.Wait()
+	return res
+}
+
+// waitForCacheSync waits for the cache until it synced, ctx is cancelled or the sync timeout of its kind expired.
+func (f *sharedCacheFactory) waitForCacheSync(ctx context.Context, key cacheKey, informer cache.SharedIndexInformer) bool {
+	timeout, ok := f.customSyncTimeout[key.gvk]
+	if !ok {
+		timeout = f.syncTimeout
+	}
+	if timeout <= 0 {
+		return cache.WaitForCacheSync(ctx.Done(), informer.HasSynced)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if cache.WaitForCacheSync(timeoutCtx.Done(), informer.HasSynced) {
+		return true
+	}
+	if ctx.Err() == nil {
+		f.lock.RLock()
+		syncs := f.syncs[key]
+		f.lock.RUnlock()
+		var listErr error
+		if syncs != nil {
+			listErr = syncs.status(true, false).LastListError
+		}
+		log.Errorf("The cache of %s did not sync within %s, last list error: %v", key, timeout, listErr)
+	}
+	return false
+}
+
+func (f *sharedCacheFactory) HasSynced() map[schema.GroupVersionKind]bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	res := map[schema.GroupVersionKind]bool{}
+	for key, informer := range f.caches {
+		synced := f.startedCaches[key] && informer.HasSynced()
+		if previous, ok := res[key.gvk]; ok {
+			synced = synced && previous
+		}
+		res[key.gvk] = synced
+	}
+	return res
+}
+
+func (f *sharedCacheFactory) SyncStatus() map[schema.GroupVersionKind]SyncStatus {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	res := map[schema.GroupVersionKind]SyncStatus{}
+	for key, informer := range f.caches {
+		started := f.startedCaches[key]
+		status := SyncStatus{Started: started, Synced: started && informer.HasSynced()}
+		if syncs := f.syncs[key]; syncs != nil {
+			status = syncs.status(status.Started, status.Synced)
+		}
+		if previous, ok := res[key.gvk]; ok {
+			status = previous.merge(status)
+		}
+		res[key.gvk] = status
 	}
 	return res
 }
@@ -163,6 +411,85 @@ func (f *sharedCacheFactory) ForKind(gvk schema.GroupVersionKind) (cache.SharedI
 }
 
 func (f *sharedCacheFactory) ForResourceKind(gvr schema.GroupVersionResource, kind string, namespaced bool) (cache.SharedIndexInformer, error) {
+	return f.ForResourceKindScope(gvr, kind, namespaced, Scope{})
+}
+
+func (f *sharedCacheFactory) ForKindScope(gvk schema.GroupVersionKind, scope Scope) (cache.SharedIndexInformer, error) {
+	gvr, namespaced, err := f.sharedClientFactory.ResourceForGVK(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return f.ForResourceKindScope(gvr, gvk.Kind, namespaced, scope)
+}
+
+func (f *sharedCacheFactory) ForResourceKindScope(gvr schema.GroupVersionResource, kind string, namespaced bool, scope Scope) (cache.SharedIndexInformer, error) {
+	_, informer, err := f.forResourceKindScope(gvr, kind, namespaced, scope, true)
+	return informer, err
+}
+
+func (f *sharedCacheFactory) Acquire(gvk schema.GroupVersionKind, scope Scope) (cache.SharedIndexInformer, ReleaseFunc, error) {
+	gvr, namespaced, err := f.sharedClientFactory.ResourceForGVK(gvk)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f.AcquireResourceKind(gvr, gvk.Kind, namespaced, scope)
+}
+
+func (f *sharedCacheFactory) AcquireResourceKind(gvr schema.GroupVersionResource, kind string, namespaced bool, scope Scope) (cache.SharedIndexInformer, ReleaseFunc, error) {
+	key, informer, err := f.forResourceKindScope(gvr, kind, namespaced, scope, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	var once sync.Once
+	return informer, func() {
+		once.Do(func() {
+			f.release(key)
+		})
+	}, nil
+}
+
+// release drops a reference on the cache and stops it after the idle timeout if it was the last one.
+func (f *sharedCacheFactory) release(key cacheKey) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.refs[key]--
+	if f.refs[key] > 0 || f.pinned[key] {
+		return
+	}
+
+	var timer clock.Timer
+	timer = f.clock.AfterFunc(f.idleTimeout, func() {
+		f.stopIdle(key, timer)
+	})
+	f.idleTimers[key] = timer
+}
+
+// stopIdle stops and removes the cache unless it was acquired again since the timer was set.
+func (f *sharedCacheFactory) stopIdle(key cacheKey, timer clock.Timer) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.idleTimers[key] != timer {
+		return
+	}
+
+	log.Debugf("Stopping idle cache for %s", key)
+	if cancel := f.cancels[key]; cancel != nil {
+		cancel()
+	}
+	delete(f.caches, key)
+	delete(f.startedCaches, key)
+	delete(f.snapshots, key)
+	delete(f.auditors, key)
+	delete(f.syncs, key)
+	delete(f.refs, key)
+	delete(f.cancels, key)
+	delete(f.idleTimers, key)
+}
+
+// forResourceKindScope returns the cache and either pins it or takes a reference on it.
+func (f *sharedCacheFactory) forResourceKindScope(gvr schema.GroupVersionResource, kind string, namespaced bool, scope Scope, pin bool) (cacheKey, cache.SharedIndexInformer, error) {
 	var (
 		gvk schema.GroupVersionKind
 		err error
@@ -171,7 +498,7 @@ func (f *sharedCacheFactory) ForResourceKind(gvr schema.GroupVersionResource, ki
 	if kind == "" {
 		gvk, err = f.sharedClientFactory.GVKForResource(gvr)
 		if err != nil {
-			return nil, err
+			return cacheKey{}, nil, err
 		}
 	} else {
 		gvk = gvr.GroupVersion().WithKind(kind)
@@ -180,9 +507,16 @@ func (f *sharedCacheFactory) ForResourceKind(gvr schema.GroupVersionResource, ki
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
-	informer, ok := f.caches[gvk]
+	key := cacheKey{gvk: gvk, scope: scope}
+	if timer := f.idleTimers[key]; timer != nil {
+		timer.Stop()
+		delete(f.idleTimers, key)
+	}
+
+	informer, ok := f.caches[key]
 	if ok {
-		return informer, nil
+		f.ref(key, pin)
+		return key, informer, nil
 	}
 
 	resyncPeriod, ok := f.customResync[gvk]
@@ -194,34 +528,151 @@ func (f *sharedCacheFactory) ForResourceKind(gvr schema.GroupVersionResource, ki
 	if !ok {
 		namespace = f.defaultNamespace
 	}
+	if scope.Namespace != "" {
+		namespace = scope.Namespace
+	}
 
 	tweakList, ok := f.customTweakList[gvk]
 	if !ok {
 		tweakList = f.tweakList
 	}
+	if scope != (Scope{}) {
+		tweakList = scope.tweakList(tweakList)
+	}
 
-	obj, objList, err := f.sharedClientFactory.NewObjects(gvk)
-	if err != nil {
-		return nil, err
+	transform, ok := f.customTransform[gvk]
+	if !ok {
+		transform = f.transform
+	}
+	if transform != nil && metrics.Enabled() {
+		transform = measureTransform(gvk, transform)
+	}
+
+	watchList, ok := f.customWatchList[gvk]
+	if !ok {
+		watchList = f.watchList
+	}
+
+	hooks, ok := f.customHooks[gvk]
+	if !ok {
+		hooks = f.hooks
+	}
+	if metrics.Enabled() {
+		hooks = measureHooks(gvk, hooks)
 	}
 
+	indexers := cache.Indexers{}
+	for name, indexFunc := range f.indexers {
+		indexers[name] = indexFunc
+	}
+	for name, indexFunc := range f.customIndexers[gvk] {
+		indexers[name] = indexFunc
+	}
+
+	var obj, objList runtime.Object
 	client := f.sharedClientFactory.ForResourceKind(gvr, kind, namespaced)
+	if f.metadataOnly[gvk] {
+		obj, objList = &v1.PartialObjectMetadata{}, &v1.PartialObjectMetadataList{}
+		client, err = client.ForMetadata()
+	} else {
+		obj, objList, err = f.sharedClientFactory.NewObjects(gvk)
+	}
+	if err != nil {
+		return key, nil, err
+	}
+
+	namespaces, multiNamespace := f.customNamespaceSets[gvk]
+	multiNamespace = multiNamespace && scope.Namespace == ""
 
-	cache := NewCache(obj, objList, client, &Options{
+	// caches of multiple namespaces are not audited
+	var audit *auditor
+	if auditOpts, ok := f.customAudit[gvk]; ok && !multiNamespace {
+		metadataClient, err := f.sharedClientFactory.ForResourceKind(gvr, kind, namespaced).ForMetadata()
+		if err != nil {
+			return key, nil, err
+		}
+		audit = &auditor{
+			key:       key,
+			client:    metadataClient,
+			namespace: namespace,
+			tweakList: tweakList,
+			opts:      applyDefaultAuditOptions(auditOpts),
+		}
+	}
+
+	// the reference is only taken once the cache can be created, a failed creation leaves no state behind
+	f.ref(key, pin)
+
+	opts := &Options{
 		Namespace:   namespace,
 		Resync:      resyncPeriod,
 		TweakList:   tweakList,
 		WaitHealthy: f.healthcheck.ensureHealthy,
-	})
-	f.caches[gvk] = cache
+		Transform:   transform,
+		WatchList:   watchList,
+		Indexers:    indexers,
+		Hooks:       hooks,
+		syncs:       &syncState{},
+	}
+	f.syncs[key] = opts.syncs
+	if multiNamespace {
+		cache := NewMultiNamespaceCache(obj, objList, client, opts, namespaces...)
+		f.caches[key] = cache
+		return key, cache, nil
+	}
+
+	// snapshots are stored per GroupVersionKind, scoped caches do not use them
+	if f.snapshotStore != nil && scope == (Scope{}) {
+		opts.snapshots = &snapshotter{
+			gvk:      gvk,
+			store:    f.snapshotStore,
+			interval: f.snapshotInterval,
+		}
+		f.snapshots[key] = opts.snapshots
+	}
+
+	// the watch error handler drops the errors of the relists requested by the audits
+	if audit != nil && opts.Hooks.WatchErrorHandler == nil {
+		opts.Hooks.WatchErrorHandler = cache.DefaultWatchErrorHandler
+	}
+
+	cache := NewCache(obj, objList, client, opts)
+	f.caches[key] = cache
+	if audit != nil {
+		audit.cache = cache.(*deferredCache)
+		f.auditors[key] = audit
+	}
 
-	return cache, nil
+	return key, cache, nil
+}
+
+// ref records a user of the cache of key, it must be called with the lock held. Pinned caches are never stopped
+// when idle.
+func (f *sharedCacheFactory) ref(key cacheKey, pin bool) {
+	if pin {
+		f.pinned[key] = true
+	} else {
+		f.refs[key]++
+	}
+}
+
+func (f *sharedCacheFactory) SubscribeHealth(ctx context.Context) <-chan bool {
+	return f.healthcheck.subscribe(ctx)
 }
 
 func (f *sharedCacheFactory) SharedClientFactory() client.SharedClientFactory {
 	return f.sharedClientFactory
 }
 
+// SyncReporter is implemented by the SharedCacheFactory returned by NewSharedCachedFactory.
+type SyncReporter interface {
+	// HasSynced reports for every cache of the factory whether it was started and synced, without waiting.
+	HasSynced() map[schema.GroupVersionKind]bool
+	// SyncStatus reports for every kind whether its caches were started and synced, how long they took to sync,
+	// the last error listing them and how often they relisted.
+	SyncStatus() map[schema.GroupVersionKind]SyncStatus
+}
+
 type SharedCacheFactory interface {
 	Start(ctx context.Context) error
 	StartGVK(ctx context.Context, gvk schema.GroupVersionKind) error
@@ -229,6 +680,8 @@ type SharedCacheFactory interface {
 	ForKind(gvk schema.GroupVersionKind) (cache.SharedIndexInformer, error)
 	ForResource(gvr schema.GroupVersionResource, namespaced bool) (cache.SharedIndexInformer, error)
 	ForResourceKind(gvr schema.GroupVersionResource, kind string, namespaced bool) (cache.SharedIndexInformer, error)
+	// WaitForCacheSync waits for the started caches to sync, but for no longer than the sync timeout of their kind,
+	// and reports which kinds synced.
 	WaitForCacheSync(ctx context.Context) map[schema.GroupVersionKind]bool
 	SharedClientFactory() client.SharedClientFactory
 }
@@ -0,0 +1,158 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/rancher/lasso/pkg/controller"
+	"github.com/rancher/lasso/pkg/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgocache "k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+var configMapGVK = corev1.SchemeGroupVersion.WithKind("ConfigMap")
+
+// newTestCacheFactory returns the cache factory of an in-memory apiserver seeded with the objects, and a context
+// that is cancelled when the test ends.
+func newTestCacheFactory(t *testing.T, opts *cache.SharedCacheFactoryOptions, objs ...runtime.Object) (*fake.Factory, cache.SharedCacheFactory, context.Context) {
+	t.Helper()
+	f, err := fake.NewSharedControllerFactory(&fake.Options{
+		ControllerOptions: &controller.SharedControllerFactoryOptions{CacheOptions: opts},
+	}, objs...)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return f, f.SharedCacheFactory(), ctx
+}
+
+// startCache starts the cache of the kind and waits for it to sync.
+func startCache(t *testing.T, ctx context.Context, caches cache.SharedCacheFactory, gvk schema.GroupVersionKind) clientgocache.SharedIndexInformer {
+	t.Helper()
+	informer, err := caches.ForKind(gvk)
+	require.NoError(t, err)
+	require.NoError(t, caches.StartGVK(ctx, gvk))
+	require.True(t, clientgocache.WaitForCacheSync(ctx.Done(), informer.HasSynced))
+	return informer
+}
+
+func eventually(t *testing.T, condition func() bool, msgAndArgs ...interface{}) {
+	t.Helper()
+	assert.Eventually(t, condition, 5*time.Second, 10*time.Millisecond, msgAndArgs...)
+}
+
+func TestFactoryStopsIdleCaches(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	_, caches, ctx := newTestCacheFactory(t, &cache.SharedCacheFactoryOptions{
+		IdleTimeout: time.Minute,
+		Clock:       fakeClock,
+	}, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}})
+
+	informer, release, err := cache.Acquire(caches, configMapGVK, cache.Scope{})
+	require.NoError(t, err)
+	same, releaseSame, err := cache.Acquire(caches, configMapGVK, cache.Scope{})
+	require.NoError(t, err)
+	assert.Same(t, informer, same)
+
+	require.NoError(t, caches.StartGVK(ctx, configMapGVK))
+	require.True(t, clientgocache.WaitForCacheSync(ctx.Done(), informer.HasSynced))
+	assert.Equal(t, []string{"default/cm"}, informer.GetStore().ListKeys())
+
+	// releasing twice drops a single reference, the cache is still referenced
+	release()
+	release()
+	assert.False(t, fakeClock.HasWaiters())
+	assert.False(t, informer.IsStopped())
+
+	releaseSame()
+	require.True(t, fakeClock.HasWaiters())
+	fakeClock.Step(time.Minute)
+	eventually(t, informer.IsStopped)
+	assert.NotContains(t, caches.(cache.SyncReporter).HasSynced(), configMapGVK)
+
+	restarted, release, err := cache.Acquire(caches, configMapGVK, cache.Scope{})
+	require.NoError(t, err)
+	assert.NotSame(t, informer, restarted)
+	require.NoError(t, caches.StartGVK(ctx, configMapGVK))
+	require.True(t, clientgocache.WaitForCacheSync(ctx.Done(), restarted.HasSynced))
+
+	// caches returned by ForKind are never stopped
+	pinned, err := caches.ForKind(configMapGVK)
+	require.NoError(t, err)
+	assert.Same(t, restarted, pinned)
+	release()
+	assert.False(t, fakeClock.HasWaiters())
+	assert.False(t, pinned.IsStopped())
+
+	// factories that do not stop idle caches hand out their pinned caches
+	plain := struct{ cache.SharedCacheFactory }{caches}
+	acquired, release, err := cache.Acquire(plain, configMapGVK, cache.Scope{})
+	require.NoError(t, err)
+	assert.Same(t, pinned, acquired)
+	release()
+	assert.False(t, fakeClock.HasWaiters())
+}
+
+func TestFactoryFailedAcquireTakesNoReference(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	f, caches, ctx := newTestCacheFactory(t, &cache.SharedCacheFactoryOptions{
+		IdleTimeout: time.Minute,
+		Clock:       fakeClock,
+	}, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}})
+
+	// the cache can not be created while the list kind is not registered
+	gvr := corev1.SchemeGroupVersion.WithResource("configmaps")
+	f.Scheme().AddKnownTypeWithName(corev1.SchemeGroupVersion.WithKind("ConfigMapAlias"), &corev1.ConfigMap{})
+	_, _, err := cache.AcquireResourceKind(caches, gvr, "ConfigMapAlias", true, cache.Scope{})
+	require.Error(t, err)
+
+	f.Scheme().AddKnownTypeWithName(corev1.SchemeGroupVersion.WithKind("ConfigMapAliasList"), &corev1.ConfigMapList{})
+	informer, release, err := cache.AcquireResourceKind(caches, gvr, "ConfigMapAlias", true, cache.Scope{})
+	require.NoError(t, err)
+	require.NoError(t, caches.StartGVK(ctx, corev1.SchemeGroupVersion.WithKind("ConfigMapAlias")))
+	require.True(t, clientgocache.WaitForCacheSync(ctx.Done(), informer.HasSynced))
+
+	// the failed Acquire left no reference behind, so releasing the only reference stops the cache
+	release()
+	require.True(t, fakeClock.HasWaiters())
+	fakeClock.Step(time.Minute)
+	eventually(t, informer.IsStopped)
+}
+
+func TestFactoryMetadataOnlyCache(t *testing.T) {
+	f, caches, ctx := newTestCacheFactory(t, &cache.SharedCacheFactoryOptions{
+		KindMetadataOnly: map[schema.GroupVersionKind]bool{
+			configMapGVK: true,
+		},
+	}, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "seeded", Namespace: "default", Labels: map[string]string{"app": "lasso"}},
+		Data:       map[string]string{"large": "data"},
+	})
+
+	informer := startCache(t, ctx, caches, configMapGVK)
+	cached, ok, err := informer.GetStore().GetByKey("default/seeded")
+	require.NoError(t, err)
+	require.True(t, ok)
+	obj, ok := cached.(*metav1.PartialObjectMetadata)
+	require.True(t, ok, "cached %T", cached)
+	assert.Equal(t, map[string]string{"app": "lasso"}, obj.Labels)
+	assert.Equal(t, configMapGVK, obj.GroupVersionKind())
+
+	// watch events are metadata only as well
+	require.NoError(t, f.Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "added", Namespace: "default"}}))
+	eventually(t, func() bool {
+		obj, ok, err := informer.GetStore().GetByKey("default/added")
+		if err != nil || !ok {
+			return false
+		}
+		_, ok = obj.(*metav1.PartialObjectMetadata)
+		return ok
+	})
+}
@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/lasso/pkg/log"
+	"github.com/rancher/lasso/pkg/metrics"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	defaultSnapshotInterval = 10 * time.Minute
+
+	snapshotHit     = "hit"
+	snapshotMiss    = "miss"
+	snapshotExpired = "expired"
+)
+
+// SnapshotStore persists snapshots of caches. A snapshot is the JSON encoded list of the cached objects, with the
+// resourceVersion the cache was synced to as the list's resourceVersion. A store must not be shared by factories
+// of different clusters.
+type SnapshotStore interface {
+	// Save stores the snapshot of the cache of the GroupVersionKind, replacing the previous one.
+	Save(gvk schema.GroupVersionKind, data []byte) error
+	// Load returns the snapshot of the cache of the GroupVersionKind and when it was saved. data is nil if there is
+	// no snapshot.
+	Load(gvk schema.GroupVersionKind) (data []byte, saved time.Time, err error)
+}
+
+// NewFileSnapshotStore returns a SnapshotStore that keeps one file per GroupVersionKind in dir, which is created
+// if it does not exist.
+func NewFileSnapshotStore(dir string) SnapshotStore {
+	return &fileSnapshotStore{
+		dir: dir,
+	}
+}
+
+type fileSnapshotStore struct {
+	dir string
+}
+
+func (f *fileSnapshotStore) path(gvk schema.GroupVersionKind) string {
+	return filepath.Join(f.dir, strings.TrimSuffix(gvk.Kind+"."+gvk.Version+"."+gvk.Group, ".")+".json")
+}
+
+func (f *fileSnapshotStore) Save(gvk schema.GroupVersionKind, data []byte) error {
+	if err := os.MkdirAll(f.dir, 0700); err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so that a crash never leaves a partial snapshot behind
+	tmp, err := os.CreateTemp(f.dir, ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(gvk))
+}
+
+func (f *fileSnapshotStore) Load(gvk schema.GroupVersionKind) ([]byte, time.Time, error) {
+	file, err := os.Open(f.path(gvk))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, nil
+	} else if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := io.ReadAll(file)
+	return data, info.ModTime(), err
+}
+
+// snapshotter starts a cache from its snapshot and saves the cache periodically. The first list of the cache is
+// answered from the snapshot, so that the informer watches from the snapshot's resourceVersion. If that
+// resourceVersion is too old, the apiserver answers the watch with 410 Gone and the informer relists from the
+// apiserver.
+type snapshotter struct {
+	gvk      schema.GroupVersionKind
+	store    SnapshotStore
+	interval time.Duration
+	// contextID labels the metrics, it is set before the cache runs
+	contextID string
+
+	lock   sync.Mutex
+	listed bool
+	loaded bool
+}
+
+// list returns the list from the snapshot for the first list of the cache, ok is false if there is none or for
+// later lists. resourceVersion is the one the informer requested.
+func (s *snapshotter) list(listObj runtime.Object, resourceVersion string) (runtime.Object, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.listed {
+		// the informer relists without resourceVersion if it could not watch from the last one
+		if s.loaded && resourceVersion == "" {
+			metrics.IncCacheSnapshotLoads(s.contextID, s.gvk, snapshotExpired)
+		}
+		s.loaded = false
+		return nil, false
+	}
+	s.listed = true
+
+	list, saved, err := s.load(listObj)
+	if err != nil {
+		log.Errorf("Failed to load snapshot of %s cache: %v", s.gvk, err)
+	}
+	if list == nil {
+		metrics.IncCacheSnapshotLoads(s.contextID, s.gvk, snapshotMiss)
+		return nil, false
+	}
+
+	s.loaded = true
+	metrics.IncCacheSnapshotLoads(s.contextID, s.gvk, snapshotHit)
+	metrics.SetCacheSnapshotAge(s.contextID, s.gvk, time.Since(saved).Seconds())
+	return list, true
+}
+
+func (s *snapshotter) load(listObj runtime.Object) (runtime.Object, time.Time, error) {
+	data, saved, err := s.store.Load(s.gvk)
+	if err != nil || data == nil {
+		return nil, saved, err
+	}
+
+	list := listObj.DeepCopyObject()
+	if err := json.Unmarshal(data, list); err != nil {
+		return nil, saved, err
+	}
+	listMeta, err := meta.ListAccessor(list)
+	if err != nil {
+		return nil, saved, err
+	}
+	if listMeta.GetResourceVersion() == "" {
+		return nil, saved, fmt.Errorf("snapshot has no resourceVersion")
+	}
+	return list, saved, nil
+}
+
+// run saves the informer's cache every interval and once more when stopCh is closed.
+func (s *snapshotter) run(stopCh <-chan struct{}, informer cache.SharedIndexInformer, listObj runtime.Object) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			s.saveSynced(informer, listObj)
+			return
+		case <-ticker.C:
+			s.saveSynced(informer, listObj)
+		}
+	}
+}
+
+func (s *snapshotter) saveSynced(informer cache.SharedIndexInformer, listObj runtime.Object) {
+	if !informer.HasSynced() {
+		return
+	}
+	// the resourceVersion is read before the objects, so that the objects are at least as new as the
+	// resourceVersion. Events between both are replayed by the watch after a restart, which is harmless.
+	resourceVersion := informer.LastSyncResourceVersion()
+	if err := s.save(resourceVersion, informer.GetStore().List(), listObj); err != nil {
+		log.Errorf("Failed to save snapshot of %s cache: %v", s.gvk, err)
+	}
+}
+
+func (s *snapshotter) save(resourceVersion string, items []interface{}, listObj runtime.Object) error {
+	if resourceVersion == "" {
+		return nil
+	}
+
+	objs := make([]runtime.Object, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(runtime.Object)
+		if !ok {
+			return fmt.Errorf("unexpected cache item %T", item)
+		}
+		objs = append(objs, obj)
+	}
+
+	list := listObj.DeepCopyObject()
+	if err := meta.SetList(list, objs); err != nil {
+		return err
+	}
+	listMeta, err := meta.ListAccessor(list)
+	if err != nil {
+		return err
+	}
+	listMeta.SetResourceVersion(resourceVersion)
+	// unstructured lists can only be decoded with their kind
+	list.GetObjectKind().SetGroupVersionKind(s.gvk.GroupVersion().WithKind(s.gvk.Kind + "List"))
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return s.store.Save(s.gvk, data)
+}
@@ -0,0 +1,54 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgocache "k8s.io/client-go/tools/cache"
+)
+
+func TestFactoryStartsFromSnapshot(t *testing.T) {
+	store := cache.NewFileSnapshotStore(t.TempDir())
+	opts := &cache.SharedCacheFactoryOptions{SnapshotStore: store}
+	// run runs the cache and returns the func that stops it, which returns once the final snapshot was saved
+	run := func(ctx context.Context, caches cache.SharedCacheFactory) (clientgocache.SharedIndexInformer, func()) {
+		informer, err := caches.ForKind(configMapGVK)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(ctx)
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			informer.Run(ctx.Done())
+		}()
+		stop := func() {
+			cancel()
+			<-stopped
+		}
+		t.Cleanup(stop)
+		return informer, stop
+	}
+
+	_, caches, ctx := newTestCacheFactory(t, opts, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "snapshotted", Namespace: "default"},
+	})
+	informer, stop := run(ctx, caches)
+	require.True(t, clientgocache.WaitForCacheSync(ctx.Done(), informer.HasSynced))
+
+	// stopping the cache saves the snapshot
+	stop()
+	data, _, err := store.Load(configMapGVK)
+	require.NoError(t, err)
+	require.NotNil(t, data)
+
+	// the second apiserver does not have the config map, only the snapshot does
+	_, caches, ctx = newTestCacheFactory(t, opts)
+	informer, _ = run(ctx, caches)
+	eventually(t, func() bool {
+		_, ok, err := informer.GetStore().GetByKey("default/snapshotted")
+		return err == nil && ok
+	})
+}
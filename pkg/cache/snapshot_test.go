@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher/lasso/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFileSnapshotStore(t *testing.T) {
+	store := NewFileSnapshotStore(t.TempDir() + "/snapshots")
+	gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+	data, _, err := store.Load(gvk)
+	require.NoError(t, err)
+	assert.Nil(t, data)
+
+	require.NoError(t, store.Save(gvk, []byte("first")))
+	require.NoError(t, store.Save(gvk, []byte("second")))
+
+	data, saved, err := store.Load(gvk)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+	assert.WithinDuration(t, time.Now(), saved, time.Minute)
+}
+
+func TestSnapshotter(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics.MustRegister(reg)
+
+	gvk := corev1.SchemeGroupVersion.WithKind("SnapshotPod")
+	s := &snapshotter{
+		gvk:   gvk,
+		store: NewFileSnapshotStore(t.TempDir()),
+	}
+
+	list, ok := s.list(&corev1.PodList{}, "0")
+	assert.False(t, ok)
+	assert.Nil(t, list)
+
+	pods := []interface{}{
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", ResourceVersion: "3"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default", ResourceVersion: "5"}},
+	}
+	require.NoError(t, s.save("7", pods, &corev1.PodList{}))
+
+	// a restarted cache lists from the snapshot once
+	s = &snapshotter{
+		gvk:   gvk,
+		store: s.store,
+	}
+	list, ok = s.list(&corev1.PodList{}, "0")
+	require.True(t, ok)
+	podList := list.(*corev1.PodList)
+	assert.Equal(t, "7", podList.ResourceVersion)
+	require.Len(t, podList.Items, 2)
+	assert.ElementsMatch(t, []string{"a", "b"}, []string{podList.Items[0].Name, podList.Items[1].Name})
+
+	// and relists from the apiserver after the snapshot expired
+	list, ok = s.list(&corev1.PodList{}, "")
+	assert.False(t, ok)
+	assert.Nil(t, list)
+
+	labels := func(result string) map[string]string {
+		return map[string]string{"kind": gvk.Kind, "result": result}
+	}
+	assert.Equal(t, 1.0, counterValue(t, reg, "lasso_controller_cache_snapshot_loads_total", labels(snapshotMiss)))
+	assert.Equal(t, 1.0, counterValue(t, reg, "lasso_controller_cache_snapshot_loads_total", labels(snapshotHit)))
+	assert.Equal(t, 1.0, counterValue(t, reg, "lasso_controller_cache_snapshot_loads_total", labels(snapshotExpired)))
+}
+
+func TestSnapshotterUnstructured(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	s := &snapshotter{
+		gvk:   gvk,
+		store: NewFileSnapshotStore(t.TempDir()),
+	}
+
+	widget := &unstructured.Unstructured{}
+	widget.SetGroupVersionKind(gvk)
+	widget.SetName("widget")
+	require.NoError(t, unstructured.SetNestedField(widget.Object, int64(3), "spec", "replicas"))
+	require.NoError(t, s.save("9", []interface{}{widget}, &unstructured.UnstructuredList{}))
+
+	list, ok := s.list(&unstructured.UnstructuredList{}, "0")
+	require.True(t, ok)
+	widgets := list.(*unstructured.UnstructuredList)
+	assert.Equal(t, "9", widgets.GetResourceVersion())
+	require.Len(t, widgets.Items, 1)
+	assert.Equal(t, widget.Object, widgets.Items[0].Object)
+}
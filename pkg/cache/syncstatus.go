@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// SyncStatus describes the caches of a kind, see SyncReporter. A kind with several caches, for example
+// selector-scoped ones, is started and synced once all of them are.
+type SyncStatus struct {
+	Started bool
+	Synced  bool
+	// SyncDuration is how long the caches took from starting to syncing, zero until they synced.
+	SyncDuration time.Duration
+	// LastListError is the error of the last failed list, for example forbidden or not found. It is reset by the
+	// next successful list.
+	LastListError error
+	// Relists counts the lists after the caches synced, which happen for example when a watch expired.
+	Relists int
+}
+
+// syncState records the start, sync and lists of a cache.
+type syncState struct {
+	lock          sync.Mutex
+	started       time.Time
+	synced        time.Time
+	relists       int
+	lastListError error
+}
+
+func (s *syncState) start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.started = time.Now()
+}
+
+// waitSynced records when the cache synced.
+func (s *syncState) waitSynced(ctx context.Context, hasSynced cache.InformerSynced) {
+	if !cache.WaitForCacheSync(ctx.Done(), hasSynced) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.synced = time.Now()
+}
+
+func (s *syncState) listed(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastListError = err
+	if err == nil && !s.synced.IsZero() {
+		s.relists++
+	}
+}
+
+func (s *syncState) status(started, synced bool) SyncStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	status := SyncStatus{
+		Started:       started,
+		Synced:        synced,
+		LastListError: s.lastListError,
+		Relists:       s.relists,
+	}
+	if synced && !s.synced.IsZero() {
+		status.SyncDuration = s.synced.Sub(s.started)
+	}
+	return status
+}
+
+// merge combines the status of another cache of the same kind.
+func (s SyncStatus) merge(other SyncStatus) SyncStatus {
+	s.Started = s.Started && other.Started
+	s.Synced = s.Synced && other.Synced
+	switch {
+	case !s.Synced:
+		s.SyncDuration = 0
+	case other.SyncDuration > s.SyncDuration:
+		s.SyncDuration = other.SyncDuration
+	}
+	if s.LastListError == nil {
+		s.LastListError = other.LastListError
+	}
+	s.Relists += other.Relists
+	return s
+}
@@ -0,0 +1,46 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFactorySyncTimeouts(t *testing.T) {
+	secretGVK := corev1.SchemeGroupVersion.WithKind("Secret")
+	f, caches, ctx := newTestCacheFactory(t, &cache.SharedCacheFactoryOptions{
+		KindSyncTimeout: map[schema.GroupVersionKind]time.Duration{secretGVK: 200 * time.Millisecond},
+	}, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}})
+	require.NoError(t, f.Forbid(secretGVK, true))
+
+	_, err := caches.ForKind(configMapGVK)
+	require.NoError(t, err)
+	_, err = caches.ForKind(secretGVK)
+	require.NoError(t, err)
+	require.NoError(t, caches.Start(ctx))
+
+	// the forbidden secrets do not sync, but only hold up WaitForCacheSync for their sync timeout
+	assert.Equal(t, map[schema.GroupVersionKind]bool{configMapGVK: true, secretGVK: false}, caches.WaitForCacheSync(ctx))
+
+	status := caches.(cache.SyncReporter).SyncStatus()
+	assert.True(t, status[configMapGVK].Started)
+	assert.True(t, status[configMapGVK].Synced)
+	assert.NoError(t, status[configMapGVK].LastListError)
+	assert.Zero(t, status[configMapGVK].Relists)
+
+	assert.True(t, status[secretGVK].Started)
+	assert.False(t, status[secretGVK].Synced)
+	assert.Zero(t, status[secretGVK].SyncDuration)
+	assert.True(t, apierrors.IsForbidden(status[secretGVK].LastListError), status[secretGVK].LastListError)
+
+	eventually(t, func() bool {
+		return caches.(cache.SyncReporter).SyncStatus()[configMapGVK].SyncDuration > 0
+	})
+}
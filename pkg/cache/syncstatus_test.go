@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncState(t *testing.T) {
+	s := &syncState{}
+	s.start()
+	listErr := errors.New("forbidden")
+	s.listed(listErr)
+	assert.Equal(t, SyncStatus{Started: true, LastListError: listErr}, s.status(true, false))
+
+	s.listed(nil)
+	s.synced = s.started.Add(time.Second)
+	assert.Equal(t, SyncStatus{Started: true, Synced: true, SyncDuration: time.Second}, s.status(true, true))
+
+	// lists after the cache synced are relists
+	s.listed(nil)
+	s.listed(nil)
+	assert.Equal(t, 2, s.status(true, true).Relists)
+}
+
+func TestSyncStatusMerge(t *testing.T) {
+	listErr := errors.New("forbidden")
+	synced := SyncStatus{Started: true, Synced: true, SyncDuration: time.Second, Relists: 1}
+
+	assert.Equal(t, SyncStatus{Started: true, Synced: true, SyncDuration: 2 * time.Second, Relists: 3},
+		synced.merge(SyncStatus{Started: true, Synced: true, SyncDuration: 2 * time.Second, Relists: 2}))
+	assert.Equal(t, SyncStatus{Started: true, LastListError: listErr, Relists: 1},
+		synced.merge(SyncStatus{Started: true, LastListError: listErr}))
+	assert.Equal(t, SyncStatus{Relists: 1}, synced.merge(SyncStatus{}))
+}
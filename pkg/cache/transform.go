@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"github.com/rancher/lasso/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// StripMetadata returns a transform that removes the managedFields and the given annotations from objects before
+// they are cached. Without annotations, the last-applied-configuration annotation of kubectl is removed. Handlers
+// of caches using it must not rely on the removed fields, and must not update objects from the cache with a full
+// update, which would drop the removed annotations on the server.
+func StripMetadata(annotations ...string) cache.TransformFunc {
+	if len(annotations) == 0 {
+		annotations = []string{corev1.LastAppliedConfigAnnotation}
+	}
+
+	return func(obj interface{}) (interface{}, error) {
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			// tombstones and other values are left as they are
+			return obj, nil
+		}
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			// SetManagedFields of unstructured objects converts the fields, removing them directly is cheaper
+			unstructured.RemoveNestedField(u.Object, "metadata", "managedFields")
+		} else {
+			m.SetManagedFields(nil)
+		}
+
+		objAnnotations := m.GetAnnotations()
+		if len(objAnnotations) == 0 {
+			return obj, nil
+		}
+		changed := false
+		for _, annotation := range annotations {
+			if _, ok := objAnnotations[annotation]; ok {
+				delete(objAnnotations, annotation)
+				changed = true
+			}
+		}
+		if changed {
+			// unstructured objects return a copy of their annotations
+			m.SetAnnotations(objAnnotations)
+		}
+		return obj, nil
+	}
+}
+
+// measureTransform wraps transform to report the estimated bytes it removes from objects of the GroupVersionKind.
+func measureTransform(gvk schema.GroupVersionKind, transform cache.TransformFunc) cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		// the size has to be taken first, transforms may modify the object in place
+		before := objectSize(obj)
+		result, err := transform(obj)
+		if err != nil {
+			return result, err
+		}
+		if saved := before - objectSize(result); saved > 0 {
+			metrics.AddCacheTransformSavedBytes(gvk, saved)
+		}
+		return result, nil
+	}
+}
+
+// objectSize estimates the serialized size of an object. Typed objects report their protobuf size, unstructured
+// objects are estimated from their content.
+func objectSize(obj interface{}) int {
+	switch o := obj.(type) {
+	case interface{ Size() int }:
+		return o.Size()
+	case *unstructured.Unstructured:
+		return contentSize(o.Object)
+	}
+	return 0
+}
+
+func contentSize(value interface{}) int {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		size := 0
+		for key, value := range v {
+			size += len(key) + contentSize(value)
+		}
+		return size
+	case []interface{}:
+		size := 0
+		for _, value := range v {
+			size += contentSize(value)
+		}
+		return size
+	case string:
+		return len(v)
+	case nil:
+		return 0
+	}
+	// numbers and booleans
+	return 8
+}
@@ -0,0 +1,41 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgocache "k8s.io/client-go/tools/cache"
+)
+
+func TestFactoryTransformsCachedObjects(t *testing.T) {
+	f, caches, ctx := newTestCacheFactory(t, &cache.SharedCacheFactoryOptions{
+		KindTransform: map[schema.GroupVersionKind]clientgocache.TransformFunc{
+			configMapGVK: cache.StripMetadata(),
+		},
+	}, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "applied",
+			Namespace: "default",
+			Annotations: map[string]string{
+				corev1.LastAppliedConfigAnnotation: "{}",
+				"keep":                             "me",
+			},
+		},
+	})
+
+	informer := startCache(t, ctx, caches, configMapGVK)
+	obj, ok, err := informer.GetStore().GetByKey("default/applied")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"keep": "me"}, obj.(*corev1.ConfigMap).Annotations)
+
+	// the apiserver keeps the complete object
+	stored, err := f.Get(configMapGVK, "default", "applied")
+	require.NoError(t, err)
+	assert.Contains(t, stored.(*corev1.ConfigMap).Annotations, corev1.LastAppliedConfigAnnotation)
+}
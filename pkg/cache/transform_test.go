@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher/lasso/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTransformPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "default",
+			Annotations: map[string]string{
+				corev1.LastAppliedConfigAnnotation: `{"apiVersion":"v1","kind":"Pod"}`,
+				"keep":                             "me",
+			},
+			ManagedFields: []metav1.ManagedFieldsEntry{{
+				Manager:  "kubectl",
+				FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:annotations":{}}}`)},
+			}},
+		},
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	transform := StripMetadata()
+
+	obj, err := transform(newTransformPod())
+	require.NoError(t, err)
+	pod := obj.(*corev1.Pod)
+	assert.Nil(t, pod.ManagedFields)
+	assert.Equal(t, map[string]string{"keep": "me"}, pod.Annotations)
+
+	// transforms must be idempotent
+	obj, err = transform(pod)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"keep": "me"}, obj.(*corev1.Pod).Annotations)
+
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name": "cm",
+			"annotations": map[string]interface{}{
+				"drop": "x",
+				"keep": "me",
+			},
+			"managedFields": []interface{}{map[string]interface{}{"manager": "kubectl"}},
+		},
+	}}
+	obj, err = StripMetadata("drop")(u)
+	require.NoError(t, err)
+	u = obj.(*unstructured.Unstructured)
+	assert.NotContains(t, u.Object["metadata"], "managedFields")
+	assert.Equal(t, map[string]string{"keep": "me"}, u.GetAnnotations())
+
+	tombstone := cache.DeletedFinalStateUnknown{Key: "default/pod", Obj: newTransformPod()}
+	obj, err = transform(tombstone)
+	require.NoError(t, err)
+	assert.Equal(t, tombstone, obj)
+}
+
+func TestMeasureTransform(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics.MustRegister(reg)
+
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "TransformedPod"}
+	pod := newTransformPod()
+	before := pod.Size()
+
+	_, err := measureTransform(gvk, StripMetadata())(pod)
+	require.NoError(t, err)
+
+	saved := before - pod.Size()
+	require.Positive(t, saved)
+	assert.Equal(t, float64(saved), counterValue(t, reg, "lasso_controller_cache_transform_saved_bytes_total", map[string]string{
+		"group":   gvk.Group,
+		"version": gvk.Version,
+		"kind":    gvk.Kind,
+	}))
+}
+
+// counterValue returns the value of the counter with the given labels, other tests of the package use the same
+// collectors.
+func counterValue(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	next:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if value, ok := labels[label.GetName()]; ok && value != label.GetValue() {
+					continue next
+				}
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/utils/ptr"
+)
+
+// streamList lists the objects with the streaming list protocol: a watch that starts with an ADDED event for every
+// object and a bookmark marking the end of the initial events. The apiserver serves it from its watch cache
+// without building the complete list in memory. The objects are returned as a list with the bookmark's
+// resourceVersion, the informer then watches from it like after a regular list.
+func (d *deferredListWatcher) streamList(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+	options.SendInitialEvents = ptr.To(true)
+	options.AllowWatchBookmarks = true
+	options.ResourceVersionMatch = metav1.ResourceVersionMatchNotOlderThan
+	options.Limit = 0
+	options.Continue = ""
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w, err := d.client.Watch(ctx, d.namespace, options)
+	if err != nil {
+		return nil, err
+	}
+	defer w.Stop()
+
+	var objs []runtime.Object
+	for {
+		var (
+			event watch.Event
+			ok    bool
+		)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case event, ok = <-w.ResultChan():
+		}
+		if !ok {
+			return nil, errors.New("watch closed before the initial events ended")
+		}
+
+		switch event.Type {
+		case watch.Added:
+			objs = append(objs, event.Object)
+		case watch.Bookmark:
+			bookmark, err := meta.Accessor(event.Object)
+			if err != nil {
+				return nil, err
+			}
+			if bookmark.GetAnnotations()[metav1.InitialEventsAnnotationKey] != "true" {
+				continue
+			}
+			list := d.listObj.DeepCopyObject()
+			if err := meta.SetList(list, objs); err != nil {
+				return nil, err
+			}
+			listMeta, err := meta.ListAccessor(list)
+			if err != nil {
+				return nil, err
+			}
+			listMeta.SetResourceVersion(bookmark.GetResourceVersion())
+			return list, nil
+		case watch.Error:
+			return nil, apierrors.FromObject(event.Object)
+		default:
+			return nil, fmt.Errorf("unexpected %s event before the initial events ended", event.Type)
+		}
+	}
+}
+
+// watchListUnsupported reports whether err means that the apiserver does not support streaming lists, older
+// apiservers reject their options as invalid.
+func watchListUnsupported(err error) bool {
+	return apierrors.IsBadRequest(err) || apierrors.IsInvalid(err)
+}
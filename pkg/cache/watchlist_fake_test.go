@@ -0,0 +1,56 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/rancher/lasso/pkg/controller"
+	"github.com/rancher/lasso/pkg/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFactoryWatchList(t *testing.T) {
+	for _, disabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("disabled=%t", disabled), func(t *testing.T) {
+			f, err := fake.NewSharedControllerFactory(&fake.Options{
+				DisableWatchList: disabled,
+				ControllerOptions: &controller.SharedControllerFactoryOptions{
+					CacheOptions: &cache.SharedCacheFactoryOptions{
+						DefaultWatchList: true,
+					},
+				},
+			}, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "seeded", Namespace: "default"},
+			})
+			require.NoError(t, err)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			informer := startCache(t, ctx, f.SharedCacheFactory(), configMapGVK)
+			_, ok, err := informer.GetStore().GetByKey("default/seeded")
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			// changes after the initial events are watched as usual
+			require.NoError(t, f.Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "added", Namespace: "default"}}))
+			eventually(t, func() bool {
+				_, ok, err := informer.GetStore().GetByKey("default/added")
+				return err == nil && ok
+			})
+
+			lists, watchLists := f.Lists()
+			if disabled {
+				assert.Zero(t, watchLists)
+				assert.Equal(t, int64(1), lists)
+			} else {
+				assert.Equal(t, int64(1), watchLists)
+				assert.Zero(t, lists)
+			}
+		})
+	}
+}
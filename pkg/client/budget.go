@@ -0,0 +1,142 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/lasso/pkg/metrics"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	globalLimiter = "global"
+	kindLimiter   = "kind"
+	verbLimiter   = "verb"
+)
+
+// requestBudget is a transport wrapper that makes every request of a SharedClientFactory wait for its kind, verb
+// and global rate limiters. Since it wraps the transport, the budgets also apply to the list and watch requests
+// of caches and to clients created with WithAgent or WithImpersonation.
+type requestBudget struct {
+	global flowcontrol.RateLimiter
+	kinds  map[schema.GroupVersionKind]flowcontrol.RateLimiter
+	verbs  map[string]flowcontrol.RateLimiter
+
+	lock      sync.RWMutex
+	resources map[schema.GroupVersionResource]schema.GroupVersionKind
+}
+
+func newRequestBudget(opts *SharedClientFactoryOptions) *requestBudget {
+	if opts.RateLimiter == nil && len(opts.KindRateLimiter) == 0 && len(opts.VerbRateLimiter) == 0 {
+		return nil
+	}
+	return &requestBudget{
+		global:    opts.RateLimiter,
+		kinds:     opts.KindRateLimiter,
+		verbs:     opts.VerbRateLimiter,
+		resources: map[schema.GroupVersionResource]schema.GroupVersionKind{},
+	}
+}
+
+// addResource records the kind of a resource, so that requests for it are charged to the kind's limiter.
+func (b *requestBudget) addResource(gvr schema.GroupVersionResource, kind string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.resources[gvr] = gvr.GroupVersion().WithKind(kind)
+}
+
+func (b *requestBudget) kindFor(gvr schema.GroupVersionResource) schema.GroupVersionKind {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.resources[gvr]
+}
+
+func (b *requestBudget) wrap(rt http.RoundTripper) http.RoundTripper {
+	return &budgetRoundTripper{
+		budget: b,
+		next:   rt,
+	}
+}
+
+type budgetRoundTripper struct {
+	budget *requestBudget
+	next   http.RoundTripper
+}
+
+func (b *budgetRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	gvr, verb := requestResource(req)
+	gvk := b.budget.kindFor(gvr)
+
+	// the global budget is waited for last, so that requests of a throttled kind do not hold global tokens
+	limiters := []struct {
+		name    string
+		limiter flowcontrol.RateLimiter
+	}{
+		{name: kindLimiter, limiter: b.budget.kinds[gvk]},
+		{name: verbLimiter, limiter: b.budget.verbs[verb]},
+		{name: globalLimiter, limiter: b.budget.global},
+	}
+	for _, l := range limiters {
+		if l.limiter == nil {
+			continue
+		}
+		start := time.Now()
+		if err := l.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+		metrics.ReportClientThrottleTime(gvk, verb, l.name, time.Since(start).Seconds())
+	}
+
+	return b.next.RoundTrip(req)
+}
+
+// requestResource determines the resource and the verb of an apiserver request from its path, for example
+// /apis/apps/v1/namespaces/default/deployments/name.
+func requestResource(req *http.Request) (schema.GroupVersionResource, string) {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	var gvr schema.GroupVersionResource
+	switch {
+	case len(parts) >= 3 && parts[0] == "api":
+		gvr.Version = parts[1]
+		parts = parts[2:]
+	case len(parts) >= 4 && parts[0] == "apis":
+		gvr.Group, gvr.Version = parts[1], parts[2]
+		parts = parts[3:]
+	default:
+		return gvr, strings.ToLower(req.Method)
+	}
+
+	// namespaces/{name}/status is a namespace subresource, namespaces/{namespace}/{resource} is a namespaced resource
+	if len(parts) >= 3 && parts[0] == "namespaces" && !(len(parts) == 3 && (parts[2] == "status" || parts[2] == "finalize")) {
+		parts = parts[2:]
+	}
+	gvr.Resource = parts[0]
+	named := len(parts) > 1
+
+	switch req.Method {
+	case http.MethodGet:
+		if named {
+			return gvr, "get"
+		}
+		if watch := req.URL.Query().Get("watch"); watch == "true" || watch == "1" {
+			return gvr, "watch"
+		}
+		return gvr, "list"
+	case http.MethodPost:
+		return gvr, "create"
+	case http.MethodPut:
+		return gvr, "update"
+	case http.MethodPatch:
+		return gvr, "patch"
+	case http.MethodDelete:
+		if named {
+			return gvr, "delete"
+		}
+		return gvr, "deletecollection"
+	}
+	return gvr, strings.ToLower(req.Method)
+}
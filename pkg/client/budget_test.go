@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+type countingRateLimiter struct {
+	flowcontrol.RateLimiter
+	waits int
+}
+
+func (c *countingRateLimiter) Wait(ctx context.Context) error {
+	c.waits++
+	return nil
+}
+
+func TestRequestResource(t *testing.T) {
+	tests := []struct {
+		method string
+		url    string
+		gvr    schema.GroupVersionResource
+		verb   string
+	}{
+		{http.MethodGet, "/api/v1/namespaces/ns/configmaps/name", schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "get"},
+		{http.MethodGet, "/api/v1/namespaces/ns/configmaps", schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "list"},
+		{http.MethodGet, "/apis/apps/v1/deployments?watch=true", schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, "watch"},
+		{http.MethodPut, "/api/v1/namespaces/name/status", schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}, "update"},
+		{http.MethodPatch, "/apis/apps/v1/namespaces/ns/deployments/name", schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, "patch"},
+		{http.MethodDelete, "/api/v1/namespaces/ns/pods", schema.GroupVersionResource{Version: "v1", Resource: "pods"}, "deletecollection"},
+		{http.MethodGet, "/version", schema.GroupVersionResource{}, "get"},
+	}
+	for _, tt := range tests {
+		gvr, verb := requestResource(httptest.NewRequest(tt.method, tt.url, nil))
+		require.Equal(t, tt.gvr, gvr, tt.url)
+		require.Equal(t, tt.verb, verb, tt.url)
+	}
+}
+
+func TestRequestBudget(t *testing.T) {
+	var (
+		global    = &countingRateLimiter{}
+		configMap = &countingRateLimiter{}
+		list      = &countingRateLimiter{}
+		requests  int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"apiVersion":"v1","kind":"ConfigMapList","items":[]}`))
+	}))
+	defer server.Close()
+
+	configMapGVR := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	factory, err := NewSharedClientFactory(&rest.Config{Host: server.URL}, &SharedClientFactoryOptions{
+		Mapper:          meta.NewDefaultRESTMapper(nil),
+		Scheme:          testSchema,
+		RateLimiter:     global,
+		KindRateLimiter: map[schema.GroupVersionKind]flowcontrol.RateLimiter{configMapGVR.GroupVersion().WithKind("ConfigMap"): configMap},
+		VerbRateLimiter: map[string]flowcontrol.RateLimiter{"list": list},
+	})
+	require.NoError(t, err)
+
+	configMaps := factory.ForResourceKind(configMapGVR, "ConfigMap", true)
+	secrets := factory.ForResourceKind(schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, "Secret", true)
+
+	ctx := context.Background()
+	require.NoError(t, configMaps.List(ctx, "ns", &v1.ConfigMapList{}, metav1.ListOptions{}))
+	require.NoError(t, secrets.List(ctx, "ns", &v1.ConfigMapList{}, metav1.ListOptions{}))
+
+	require.Equal(t, 2, requests)
+	require.Equal(t, 2, global.waits)
+	require.Equal(t, 1, configMap.waits)
+	require.Equal(t, 2, list.waits)
+}
@@ -32,6 +32,8 @@ type Client struct {
 	prefix     []string
 	apiVersion string
 	kind       string
+	// metadata requests PartialObjectMetadata instead of complete objects, see ForMetadata
+	metadata bool
 }
 
 // IsNamespaced determines if the give GroupVersionResource is namespaced using the given RESTMapper.
@@ -136,7 +138,7 @@ func (c *Client) Get(ctx context.Context, namespace, name string, result runtime
 	defer c.setKind(result)
 	ctx, cancel := c.setupCtx(ctx)
 	defer cancel()
-	err = c.RESTClient.Get().
+	err = c.accept(c.RESTClient.Get(), false).
 		Prefix(c.prefix...).
 		NamespaceIfScoped(namespace, c.Namespaced).
 		Resource(c.resource).
@@ -144,7 +146,7 @@ func (c *Client) Get(ctx context.Context, namespace, name string, result runtime
 		VersionedParams(&options, metav1.ParameterCodec).
 		Do(ctx).
 		Into(result)
-	return
+	return c.metadataError(err)
 }
 
 // List will attempt to find resources in the given namespace (if client.Namespaced is set to true).
@@ -158,7 +160,7 @@ func (c *Client) List(ctx context.Context, namespace string, result runtime.Obje
 	if opts.TimeoutSeconds != nil {
 		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
 	}
-	r := c.RESTClient.Get()
+	r := c.accept(c.RESTClient.Get(), true)
 	if namespace != "" {
 		r = r.NamespaceIfScoped(namespace, c.Namespaced)
 	}
@@ -168,7 +170,13 @@ func (c *Client) List(ctx context.Context, namespace string, result runtime.Obje
 		Timeout(timeout).
 		Do(ctx).
 		Into(result)
-	return
+	if err == nil && c.metadata {
+		err = meta.EachListItem(result, func(obj runtime.Object) error {
+			c.setKind(obj)
+			return nil
+		})
+	}
+	return c.metadataError(err)
 }
 
 // Watch will attempt to start a watch request with the kube-apiserver for resources in the given namespace (if client.Namespaced is set to true).
@@ -180,13 +188,14 @@ func (c *Client) Watch(ctx context.Context, namespace string, opts metav1.ListOp
 		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
 	}
 	opts.Watch = true
-	return c.injectKind(c.RESTClient.Get().
+	w, err := c.injectKind(c.accept(c.RESTClient.Get(), false).
 		Prefix(c.prefix...).
 		NamespaceIfScoped(namespace, c.Namespaced).
 		Resource(c.resource).
 		VersionedParams(&opts, metav1.ParameterCodec).
 		Timeout(timeout).
 		Watch(ctx))
+	return w, c.metadataError(err)
 }
 
 // Create will attempt create the provided object in the given namespace (if client.Namespaced is set to true).
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/rest"
+)
+
+// The accept headers have no fallback to complete objects, apiservers that can not serve metadata answer with
+// 406 Not Acceptable, see metadataError.
+const (
+	metadataAccept     = "application/vnd.kubernetes.protobuf;as=PartialObjectMetadata;g=meta.k8s.io;v=v1,application/json;as=PartialObjectMetadata;g=meta.k8s.io;v=v1"
+	metadataListAccept = "application/vnd.kubernetes.protobuf;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1,application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1"
+)
+
+// metadataScheme decodes the PartialObjectMetadata and PartialObjectMetadataList returned for metadata requests,
+// as well as the Status and WatchEvent types of the apiserver.
+var metadataScheme = runtime.NewScheme()
+
+func init() {
+	metav1.AddToGroupVersion(metadataScheme, schema.GroupVersion{Version: "v1"})
+	if err := metav1.AddMetaToScheme(metadataScheme); err != nil {
+		panic(err)
+	}
+}
+
+// ForMetadata returns a copy of the Client whose Get, List and Watch requests ask the apiserver for
+// PartialObjectMetadata and PartialObjectMetadataList instead of complete objects. The results must be decoded
+// into these types. Their kind is set to the kind of the client, so that they tell which objects they describe.
+// The client is meant for reading, writes should go through the original Client.
+func (c *Client) ForMetadata() (*Client, error) {
+	client := *c
+	config := c.Config
+	config.NegotiatedSerializer = unstructuredNegotiator{
+		NegotiatedSerializer: serializer.NewCodecFactory(metadataScheme).WithoutConversion(),
+	}
+	restClient, err := rest.UnversionedRESTClientFor(&config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to created metadata restClient for [%s]: %w", c.GVR, err)
+	}
+	client.RESTClient = restClient
+	client.Config = config
+	client.metadata = true
+	return &client, nil
+}
+
+func (c *Client) accept(r *rest.Request, list bool) *rest.Request {
+	switch {
+	case !c.metadata:
+		return r
+	case list:
+		return r.SetHeader("Accept", metadataListAccept)
+	default:
+		return r.SetHeader("Accept", metadataAccept)
+	}
+}
+
+// metadataError explains the error of a metadata request to an apiserver that does not serve PartialObjectMetadata,
+// for example an aggregated apiserver.
+func (c *Client) metadataError(err error) error {
+	if c.metadata && apierrors.IsNotAcceptable(err) {
+		return fmt.Errorf("%s is not served as PartialObjectMetadata, use a cache of complete objects: %w", c.GVR, err)
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (r roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r(req)
+}
+
+func TestClient_MetadataNotAcceptable(t *testing.T) {
+	var accepts []string
+	config := rest.Config{
+		Host: "https://lasso.test",
+		// an apiserver that only serves complete objects
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			accepts = append(accepts, req.Header.Get("Accept"))
+			return &http.Response{
+				StatusCode: http.StatusNotAcceptable,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(bytes.NewBufferString(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotAcceptable","code":406}`)),
+			}, nil
+		}),
+	}
+	gvr := schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+	c := NewClient(gvr, "PodMetrics", true, nil, 0)
+	c.Config = config
+	metadataClient, err := c.ForMetadata()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = metadataClient.Get(ctx, "default", "pod", &metav1.PartialObjectMetadata{}, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotAcceptable(err), err)
+	assert.ErrorContains(t, err, "metrics.k8s.io/v1beta1, Resource=pods is not served as PartialObjectMetadata")
+
+	err = metadataClient.List(ctx, "default", &metav1.PartialObjectMetadataList{}, metav1.ListOptions{})
+	assert.True(t, apierrors.IsNotAcceptable(err), err)
+
+	_, err = metadataClient.Watch(ctx, "default", metav1.ListOptions{})
+	assert.True(t, apierrors.IsNotAcceptable(err), err)
+
+	// complete objects are never accepted in place of metadata
+	require.Len(t, accepts, 3)
+	for _, accept := range accepts {
+		for _, mediaType := range strings.Split(accept, ",") {
+			assert.Contains(t, mediaType, ";as=PartialObjectMetadata")
+		}
+	}
+}
@@ -15,11 +15,22 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
 )
 
 type SharedClientFactoryOptions struct {
 	Mapper meta.RESTMapper
 	Scheme *runtime.Scheme
+
+	// RateLimiter is a request budget shared by every client of the factory, in addition to the QPS and Burst of
+	// the rest.Config.
+	RateLimiter flowcontrol.RateLimiter
+	// KindRateLimiter limits the requests per GroupVersionKind, so that a single busy kind can not use up the
+	// budget of the others.
+	KindRateLimiter map[schema.GroupVersionKind]flowcontrol.RateLimiter
+	// VerbRateLimiter limits the requests per verb: get, list, watch, create, update, patch, delete and
+	// deletecollection.
+	VerbRateLimiter map[string]flowcontrol.RateLimiter
 }
 
 type SharedClientFactory interface {
@@ -34,6 +45,25 @@ type SharedClientFactory interface {
 	IsHealthy(ctx context.Context) bool
 }
 
+// ProbingClientFactory is implemented by the SharedClientFactory returned by NewSharedClientFactory.
+type ProbingClientFactory interface {
+	// Probe requests the path of the apiserver, for example /readyz, /livez or /version, and returns an error
+	// unless it succeeds.
+	Probe(ctx context.Context, path string) error
+}
+
+// Probe requests the path of the apiserver, see ProbingClientFactory. Factories that can not probe a path are
+// asked IsHealthy instead.
+func Probe(ctx context.Context, factory SharedClientFactory, path string) error {
+	if probing, ok := factory.(ProbingClientFactory); ok {
+		return probing.Probe(ctx, path)
+	}
+	if !factory.IsHealthy(ctx) {
+		return fmt.Errorf("apiserver is not healthy, %T can not probe %s", factory, path)
+	}
+	return nil
+}
+
 type sharedClientFactory struct {
 	createLock sync.RWMutex
 	discovery  discovery.DiscoveryInterface
@@ -41,6 +71,7 @@ type sharedClientFactory struct {
 	timeout    time.Duration
 	rest       rest.Interface
 	config     *rest.Config
+	budget     *requestBudget
 
 	Mapper meta.RESTMapper
 	Scheme *runtime.Scheme
@@ -57,6 +88,10 @@ func NewSharedClientFactory(config *rest.Config, opts *SharedClientFactoryOption
 	}
 
 	config, timeout := populateConfig(opts.Scheme, config)
+	budget := newRequestBudget(opts)
+	if budget != nil {
+		config.Wrap(budget.wrap)
+	}
 	rest, err := rest.UnversionedRESTClientFor(config)
 	if err != nil {
 		return nil, err
@@ -74,6 +109,7 @@ func NewSharedClientFactory(config *rest.Config, opts *SharedClientFactoryOption
 		Mapper:    opts.Mapper,
 		rest:      rest,
 		config:    config,
+		budget:    budget,
 		discovery: discovery,
 	}, nil
 }
@@ -104,8 +140,12 @@ func (s *sharedClientFactory) GVKForResource(gvr schema.GroupVersionResource) (s
 }
 
 func (s *sharedClientFactory) IsHealthy(ctx context.Context) bool {
-	_, err := s.rest.Get().AbsPath("/version").Do(ctx).Raw()
-	return err == nil
+	return s.Probe(ctx, "/version") == nil
+}
+
+func (s *sharedClientFactory) Probe(ctx context.Context, path string) error {
+	_, err := s.rest.Get().AbsPath(path).Do(ctx).Raw()
+	return err
 }
 
 func (s *sharedClientFactory) IsNamespaced(gvk schema.GroupVersionKind) (bool, error) {
@@ -190,6 +230,9 @@ func (s *sharedClientFactory) ForResourceKind(gvr schema.GroupVersionResource, k
 	}
 
 	client = NewClient(gvr, kind, namespaced, s.rest, s.timeout)
+	if s.budget != nil {
+		s.budget.addResource(gvr, kind)
+	}
 	if s.config != nil {
 		client.Config = *s.config
 	}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rancher/lasso/pkg/log"
+	"github.com/rancher/lasso/pkg/metrics"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+const defaultMaxBatchSize = 50
+
+// BatchItem is a single key handed to a BatchHandler. Object is nil if the object no longer exists.
+type BatchItem struct {
+	Key    string
+	Object runtime.Object
+}
+
+// BatchHandler processes several keys in one invocation. The returned map holds the error of every key
+// that failed, keys that are absent or map to a nil error are considered successful. Failed keys are
+// requeued individually using the controller's rate limiter.
+type BatchHandler interface {
+	OnChangeBatch(items []BatchItem) map[string]error
+}
+
+type BatchHandlerFunc func(items []BatchItem) map[string]error
+
+func (b BatchHandlerFunc) OnChangeBatch(items []BatchItem) map[string]error {
+	return b(items)
+}
+
+// BatchOptions enables batching for the shared controllers of a kind, see SharedControllerFactoryOptions.KindBatch.
+type BatchOptions struct {
+	// MaxBatchSize and Wait are the controller's Options.MaxBatchSize and Options.BatchWait.
+	MaxBatchSize int
+	Wait         time.Duration
+}
+
+// SharedBatchController is implemented by the shared controllers of a SharedControllerFactory. Batch handlers
+// of kinds in SharedControllerFactoryOptions.KindBatch get up to MaxBatchSize keys at once, batch handlers of other
+// kinds get one key at a time.
+type SharedBatchController interface {
+	SharedController
+
+	RegisterBatchHandler(ctx context.Context, name string, handler BatchHandler)
+}
+
+// NewBatch creates a controller that passes up to Options.MaxBatchSize ready keys to the handler at once,
+// waiting up to Options.BatchWait for a batch to fill up.
+func NewBatch(name string, informer cache.SharedIndexInformer, startCache func(context.Context) error, handler BatchHandler, opts *Options) Controller {
+	c := newController(name, informer, startCache, nil, opts)
+	c.batchHandler = handler
+	return c
+}
+
+// feedBatches moves keys from the workqueue to the batch workers. Keys are only taken off the queue when a
+// worker is ready to receive them, so at most one key is held outside the queue at any time.
+func (c *controller) feedBatches(stopCh <-chan struct{}) {
+	defer close(c.batchItems)
+	for {
+		obj, shutdown := c.workqueue.Get()
+		if shutdown {
+			return
+		}
+		select {
+		case c.batchItems <- obj:
+		case <-stopCh:
+			c.workqueue.Done(obj)
+			return
+		}
+	}
+}
+
+func (c *controller) runBatchWorker() {
+	for c.processNextBatch() {
+	}
+}
+
+func (c *controller) processNextBatch() bool {
+	first, ok := <-c.batchItems
+	if !ok {
+		return false
+	}
+
+	batch := c.collectBatch([]interface{}{first})
+	c.processBatch(batch)
+	return true
+}
+
+func (c *controller) collectBatch(batch []interface{}) []interface{} {
+	if c.batchWait <= 0 {
+		for len(batch) < c.batchSize {
+			select {
+			case obj, ok := <-c.batchItems:
+				if !ok {
+					return batch
+				}
+				batch = append(batch, obj)
+			default:
+				return batch
+			}
+		}
+		return batch
+	}
+
+	timer := c.clock.NewTimer(c.batchWait)
+	defer timer.Stop()
+	for len(batch) < c.batchSize {
+		select {
+		case obj, ok := <-c.batchItems:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, obj)
+		case <-timer.C():
+			return batch
+		}
+	}
+	return batch
+}
+
+func (c *controller) processBatch(batch []interface{}) {
+	defer c.trackProgress()()
+
+	items := make([]BatchItem, 0, len(batch))
+	errs := map[string]error{}
+
+	for _, obj := range batch {
+		key, ok := obj.(string)
+		if !ok {
+			c.workqueue.Forget(obj)
+			c.workqueue.Done(obj)
+			log.Errorf("expected string in workqueue but got %#v", obj)
+			continue
+		}
+
+		item, exists, err := c.informer.GetStore().GetByKey(key)
+		if err != nil {
+			metrics.IncTotalHandlerExecutions(c.name, "", true)
+			errs[key] = err
+			continue
+		}
+		if exists {
+			items = append(items, BatchItem{Key: key, Object: item.(runtime.Object)})
+		} else {
+			items = append(items, BatchItem{Key: key})
+		}
+	}
+
+	if len(items) > 0 {
+		for key, err := range c.batchHandler.OnChangeBatch(items) {
+			if err != nil {
+				errs[key] = err
+			}
+		}
+	}
+
+	for _, obj := range batch {
+		key, ok := obj.(string)
+		if !ok {
+			continue
+		}
+		if err, failed := errs[key]; failed {
+			c.workqueue.AddRateLimited(key)
+			if !strings.Contains(err.Error(), "please apply your changes to the latest version and try again") {
+				log.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+			}
+		} else {
+			c.workqueue.Forget(key)
+			metrics.SetLastSuccessfulReconcile(c.name, c.clock.Now())
+		}
+		c.workqueue.Done(key)
+	}
+}
@@ -0,0 +1,97 @@
+package controller_test
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rancher/lasso/pkg/controller"
+	"github.com/rancher/lasso/pkg/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFactoryBatchesKeys(t *testing.T) {
+	f, ctx := newTestFactory(t, &fake.Options{
+		ControllerOptions: &controller.SharedControllerFactoryOptions{
+			KindBatch: map[schema.GroupVersionKind]controller.BatchOptions{configMapGVK: {MaxBatchSize: 10, Wait: 200 * time.Millisecond}},
+		},
+	},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "default"}},
+	)
+
+	configMaps := forKind(t, f, configMapGVK)
+	var (
+		lock    sync.Mutex
+		batches [][]string
+	)
+	configMaps.(controller.SharedBatchController).RegisterBatchHandler(ctx, "batch", controller.BatchHandlerFunc(func(items []controller.BatchItem) map[string]error {
+		lock.Lock()
+		defer lock.Unlock()
+		var keys []string
+		for _, item := range items {
+			keys = append(keys, item.Key)
+		}
+		sort.Strings(keys)
+		batches = append(batches, keys)
+		return nil
+	}))
+	require.NoError(t, f.Start(ctx, 1))
+
+	// the seeded keys are queued before the workers start and are handled together
+	eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return assert.ObjectsAreEqual([][]string{{"default/a", "default/b", "default/c"}}, batches)
+	})
+}
+
+func TestFactoryBatchErrorsUpdateStatus(t *testing.T) {
+	pdbGVK := policyv1.SchemeGroupVersion.WithKind("PodDisruptionBudget")
+	f, ctx := newTestFactory(t, &fake.Options{
+		ControllerOptions: &controller.SharedControllerFactoryOptions{
+			KindStatus: map[schema.GroupVersionKind]bool{pdbGVK: true},
+			KindBatch:  map[schema.GroupVersionKind]controller.BatchOptions{pdbGVK: {MaxBatchSize: 10}},
+		},
+	}, &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "pdb", Namespace: "default"},
+	})
+
+	// the non batch handler succeeds, the status must still report the failure of the batch handler
+	pdbs := forKind(t, f, pdbGVK)
+	pdbs.RegisterHandler(ctx, "noop", controller.SharedControllerHandlerFunc(func(key string, obj runtime.Object) (runtime.Object, error) {
+		return obj, nil
+	}))
+	pdbs.(controller.SharedBatchController).RegisterBatchHandler(ctx, "batch", controller.BatchHandlerFunc(func(items []controller.BatchItem) map[string]error {
+		errs := map[string]error{}
+		for _, item := range items {
+			errs[item.Key] = errors.New("batch failed")
+		}
+		return errs
+	}))
+	require.NoError(t, f.Start(ctx, 1))
+
+	eventually(t, func() bool {
+		obj, err := f.Get(pdbGVK, "default", "pdb")
+		if err != nil {
+			return false
+		}
+		conditions := obj.(*policyv1.PodDisruptionBudget).Status.Conditions
+		return meta.IsStatusConditionTrue(conditions, controller.ConditionFailed) &&
+			meta.IsStatusConditionFalse(conditions, controller.ConditionReady)
+	})
+	obj, err := f.Get(pdbGVK, "default", "pdb")
+	require.NoError(t, err)
+	failed := meta.FindStatusCondition(obj.(*policyv1.PodDisruptionBudget).Status.Conditions, controller.ConditionFailed)
+	assert.Contains(t, failed.Message, "handler batch: batch failed")
+}
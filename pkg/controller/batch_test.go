@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+type recordingRateLimiter struct {
+	workqueue.RateLimiter
+	limited   []interface{}
+	forgotten []interface{}
+}
+
+func (r *recordingRateLimiter) When(item interface{}) time.Duration {
+	r.limited = append(r.limited, item)
+	return time.Hour
+}
+
+func (r *recordingRateLimiter) Forget(item interface{}) {
+	r.forgotten = append(r.forgotten, item)
+}
+
+func TestBatchController(t *testing.T) {
+	informer := cache.NewSharedIndexInformer(nil, &corev1.ConfigMap{}, 0, cache.Indexers{})
+	for _, name := range []string{"a", "b"} {
+		assert.NoError(t, informer.GetStore().Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"}}))
+	}
+
+	var batches [][]BatchItem
+	rateLimiter := &recordingRateLimiter{}
+	c := NewBatch("test", informer, func(context.Context) error { return nil }, BatchHandlerFunc(func(items []BatchItem) map[string]error {
+		batches = append(batches, items)
+		return map[string]error{
+			"ns/b": errors.New("failed"),
+		}
+	}), &Options{
+		RateLimiter:  rateLimiter,
+		MaxBatchSize: 3,
+		BatchWait:    time.Second,
+	}).(*controller)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c.workqueue = c.newWorkqueue()
+	c.batchItems = make(chan interface{})
+	go c.feedBatches(ctx.Done())
+
+	for _, key := range []string{"ns/a", "ns/b", "ns/deleted", "ns/ignored"} {
+		c.workqueue.Add(key)
+	}
+
+	assert.True(t, c.processNextBatch())
+	if assert.Len(t, batches, 1) {
+		assert.Len(t, batches[0], 3)
+		assert.Equal(t, "ns/a", batches[0][0].Key)
+		assert.NotNil(t, batches[0][0].Object)
+		assert.Equal(t, "ns/deleted", batches[0][2].Key)
+		assert.Nil(t, batches[0][2].Object)
+	}
+
+	assert.Equal(t, []interface{}{"ns/b"}, rateLimiter.limited)
+	sort.Slice(rateLimiter.forgotten, func(i, j int) bool {
+		return rateLimiter.forgotten[i].(string) < rateLimiter.forgotten[j].(string)
+	})
+	assert.Equal(t, []interface{}{"ns/a", "ns/deleted"}, rateLimiter.forgotten)
+}
+
+func TestSharedHandlerOnChangeBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		single  []string
+		batches [][]string
+	)
+	h := &SharedHandler{controllerGVR: "test"}
+	h.Register(ctx, "single", SharedControllerHandlerFunc(func(key string, obj runtime.Object) (runtime.Object, error) {
+		single = append(single, key)
+		if key == "ns/a" {
+			return obj, errors.New("single failed")
+		}
+		return obj, nil
+	}))
+	h.RegisterBatch(ctx, "batch", BatchHandlerFunc(func(items []BatchItem) map[string]error {
+		var keys []string
+		for _, item := range items {
+			keys = append(keys, item.Key)
+		}
+		batches = append(batches, keys)
+		return map[string]error{"ns/b": errors.New("batch failed"), "ns/c": nil}
+	}))
+
+	errs := h.OnChangeBatch([]BatchItem{{Key: "ns/a"}, {Key: "ns/b"}, {Key: "ns/c"}})
+	assert.Equal(t, []string{"ns/a", "ns/b", "ns/c"}, single)
+	assert.Equal(t, [][]string{{"ns/a", "ns/b", "ns/c"}}, batches)
+	assert.Len(t, errs, 2)
+	assert.ErrorContains(t, errs["ns/a"], "handler single: single failed")
+	assert.ErrorContains(t, errs["ns/b"], "handler batch: batch failed")
+
+	// without batching the batch handlers get one key at a time
+	err := h.OnChange("ns/b", nil)
+	assert.ErrorContains(t, err, "handler batch: batch failed")
+	assert.Equal(t, []string{"ns/b"}, batches[1])
+}
@@ -20,6 +20,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
 )
 
 const maxTimeout2min = 2 * time.Minute
@@ -58,6 +59,28 @@ type controller struct {
 	startKeys   []startKey
 	started     bool
 	startCache  func(context.Context) error
+
+	namespaceFairness   bool
+	namespaceWeight     NamespaceWeightFunc
+	maxNamespaceMetrics int
+
+	batchHandler BatchHandler
+	batchSize    int
+	batchWait    time.Duration
+	batchItems   chan interface{}
+
+	clock        clock.WithTicker
+	synchronous  bool
+	syncQueue    *synchronousDelayingQueue
+	registration cache.ResourceEventHandlerRegistration
+
+	workers int
+	// progressLock guards the start times of the keys the workers are busy with and the time a worker last
+	// picked up or finished a key
+	progressLock sync.Mutex
+	inFlight     map[int64]time.Time
+	nextInFlight int64
+	lastProgress time.Time
 }
 
 type startKey struct {
@@ -68,9 +91,38 @@ type startKey struct {
 type Options struct {
 	RateLimiter            workqueue.RateLimiter
 	SyncOnlyChangedObjects bool
+
+	// NamespaceFairness keeps a sub-queue per namespace and hands keys to the workers in a round-robin
+	// across the namespaces that have pending work, so a single namespace with many objects cannot
+	// starve the others. Deduplication and rate limiting behave the same as with the default queue.
+	NamespaceFairness bool
+	// NamespaceWeight optionally turns the round-robin into a weighted one, a namespace with weight n
+	// gets up to n keys processed each time it is visited. Only used if NamespaceFairness is enabled.
+	NamespaceWeight NamespaceWeightFunc
+	// MaxNamespaceMetrics bounds how many namespaces get their own queue depth series, the remaining
+	// namespaces are aggregated. Defaults to 25.
+	MaxNamespaceMetrics int
+
+	// MaxBatchSize is the maximum number of keys passed to a BatchHandler in one call. Defaults to 50.
+	// Only used by controllers that have a BatchHandler, see NewBatch and SharedBatchController.
+	MaxBatchSize int
+	// BatchWait is how long a worker waits for more keys to become ready before calling the BatchHandler
+	// with a partial batch. If 0, a batch is made of the keys that are ready when the first key is picked up.
+	BatchWait time.Duration
+
+	// Synchronous disables the workers, keys are only processed when ProcessUntilIdle is called on the
+	// controller, see SynchronousController. This is intended for tests.
+	Synchronous bool
+	// Clock is used by the workqueue for delayed and rate limited keys. Defaults to the real clock, tests can
+	// pass a fake clock so that ProcessUntilIdle moves time forward instead of waiting.
+	Clock clock.WithTicker
 }
 
 func New(name string, informer cache.SharedIndexInformer, startCache func(context.Context) error, handler Handler, opts *Options) Controller {
+	return newController(name, informer, startCache, handler, opts)
+}
+
+func newController(name string, informer cache.SharedIndexInformer, startCache func(context.Context) error, handler Handler, opts *Options) *controller {
 	opts = applyDefaultOptions(opts)
 
 	controller := &controller{
@@ -79,9 +131,19 @@ func New(name string, informer cache.SharedIndexInformer, startCache func(contex
 		informer:    informer,
 		rateLimiter: opts.RateLimiter,
 		startCache:  startCache,
+
+		namespaceFairness:   opts.NamespaceFairness,
+		namespaceWeight:     opts.NamespaceWeight,
+		maxNamespaceMetrics: opts.MaxNamespaceMetrics,
+
+		batchSize: opts.MaxBatchSize,
+		batchWait: opts.BatchWait,
+
+		clock:       opts.Clock,
+		synchronous: opts.Synchronous,
 	}
 
-	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	controller.registration, _ = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: controller.handleObject,
 		UpdateFunc: func(old, new interface{}) {
 			if !opts.SyncOnlyChangedObjects || old.(ResourceVersionGetter).GetResourceVersion() != new.(ResourceVersionGetter).GetResourceVersion() {
@@ -111,6 +173,14 @@ func applyDefaultOptions(opts *Options) *Options {
 			workqueue.NewItemExponentialFailureRateLimiter(5*time.Millisecond, 30*time.Second),
 		)
 	}
+
+	if newOpts.MaxBatchSize <= 0 {
+		newOpts.MaxBatchSize = defaultMaxBatchSize
+	}
+
+	if newOpts.Clock == nil {
+		newOpts.Clock = clock.RealClock{}
+	}
 	return &newOpts
 }
 
@@ -122,13 +192,13 @@ func (c *controller) GroupVersionKind() schema.GroupVersionKind {
 	return c.gvk
 }
 
-func (c *controller) run(workers int, stopCh <-chan struct{}) {
-	c.startLock.Lock()
+// startWorkqueue must be called with startLock held
+func (c *controller) startWorkqueue() {
 	// we have to defer queue creation until we have a stopCh available because a workqueue
 	// will create a goroutine under the hood.  It we instantiate a workqueue we must have
 	// a mechanism to Shutdown it down.  Without the stopCh we don't know when to shutdown
 	// the queue and release the goroutine
-	c.workqueue = workqueue.NewNamedRateLimitingQueue(c.rateLimiter, c.name)
+	c.workqueue = c.newWorkqueue()
 	for _, start := range c.startKeys {
 		if start.after == 0 {
 			c.workqueue.Add(start.key)
@@ -137,18 +207,31 @@ func (c *controller) run(workers int, stopCh <-chan struct{}) {
 		}
 	}
 	c.startKeys = nil
+}
+
+func (c *controller) run(workers int, stopCh <-chan struct{}) {
+	c.startLock.Lock()
+	c.startWorkqueue()
 	c.startLock.Unlock()
 
 	defer utilruntime.HandleCrash()
 	defer func() {
 		c.workqueue.ShutDown()
+		metrics.UnregisterOldestQueuedKey(c.name)
 	}()
 
 	// Start the informer factories to begin populating the informer caches
 	log.Infof("Starting %s controller", c.name)
 
+	worker := c.runWorker
+	if c.batchHandler != nil {
+		c.batchItems = make(chan interface{})
+		go c.feedBatches(stopCh)
+		worker = c.runBatchWorker
+	}
+
 	for i := 0; i < workers; i++ {
-		go wait.Until(c.runWorker, time.Second, stopCh)
+		go wait.Until(worker, time.Second, stopCh)
 	}
 
 	<-stopCh
@@ -158,14 +241,54 @@ func (c *controller) run(workers int, stopCh <-chan struct{}) {
 	log.Infof("Shutting down %s workers", c.name)
 }
 
+func (c *controller) newWorkqueue() workqueue.RateLimitingInterface {
+	queueConfig := workqueue.QueueConfig{
+		Name:  c.name,
+		Clock: c.clock,
+	}
+	if c.namespaceFairness {
+		queueConfig.Queue = newNamespaceFairQueue(c.name, c.namespaceWeight, c.maxNamespaceMetrics)
+	}
+
+	rateLimiter := c.rateLimiter
+	if metrics.Enabled() {
+		if queueConfig.Queue == nil {
+			queueConfig.Queue = workqueue.DefaultQueue[interface{}]()
+		}
+		queue := newInstrumentedQueue(c.name, queueConfig.Queue, c.clock)
+		metrics.RegisterOldestQueuedKey(c.name, queue.oldest)
+		queueConfig.Queue = queue
+		rateLimiter = newInstrumentedRateLimiter(c.name, rateLimiter)
+	}
+
+	var delayingQueue workqueue.DelayingInterface
+	if c.synchronous {
+		c.syncQueue = newSynchronousDelayingQueue(workqueue.NewWithConfig(queueConfig), c.clock)
+		delayingQueue = c.syncQueue
+	} else {
+		delayingQueue = workqueue.NewDelayingQueueWithConfig(workqueue.DelayingQueueConfig{
+			Name:  c.name,
+			Clock: c.clock,
+			Queue: workqueue.NewWithConfig(queueConfig),
+		})
+	}
+
+	return workqueue.NewRateLimitingQueueWithConfig(rateLimiter, workqueue.RateLimitingQueueConfig{
+		Name:          c.name,
+		Clock:         c.clock,
+		DelayingQueue: delayingQueue,
+	})
+}
+
 func (c *controller) Start(ctx context.Context, workers int) error {
 	c.startLock.Lock()
-	defer c.startLock.Unlock()
-
-	if c.started {
+	started := c.started
+	c.startLock.Unlock()
+	if started {
 		return nil
 	}
 
+	// the start lock is not held while the cache syncs, keys enqueued in the meantime are kept in startKeys
 	if err := c.startCache(ctx); err != nil {
 		return err
 	}
@@ -174,6 +297,31 @@ func (c *controller) Start(ctx context.Context, workers int) error {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
+	c.startLock.Lock()
+	defer c.startLock.Unlock()
+	if c.started {
+		return nil
+	}
+
+	if c.synchronous {
+		// no workers, keys are processed by ProcessUntilIdle
+		c.startWorkqueue()
+		go func() {
+			<-ctx.Done()
+			c.startLock.Lock()
+			defer c.startLock.Unlock()
+			c.workqueue.ShutDown()
+			metrics.UnregisterOldestQueuedKey(c.name)
+			c.started = false
+		}()
+		c.started = true
+		return nil
+	}
+
+	c.workers = workers
+	c.progressLock.Lock()
+	c.lastProgress = c.clock.Now()
+	c.progressLock.Unlock()
 	go c.run(workers, ctx.Done())
 	c.started = true
 	return nil
@@ -208,6 +356,7 @@ func (c *controller) processSingleItem(obj interface{}) error {
 	)
 
 	defer c.workqueue.Done(obj)
+	defer c.trackProgress()()
 
 	if key, ok = obj.(string); !ok {
 		c.workqueue.Forget(obj)
@@ -220,6 +369,7 @@ func (c *controller) processSingleItem(obj interface{}) error {
 	}
 
 	c.workqueue.Forget(obj)
+	metrics.SetLastSuccessfulReconcile(c.name, c.clock.Now())
 	return nil
 }
 
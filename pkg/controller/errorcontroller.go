@@ -2,28 +2,56 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
 )
 
+var errNotConstructed = errors.New("the controller is not constructed yet, its construction is being retried")
+
+// errorController stands in for a shared controller that could not be constructed yet. It remembers the keys
+// enqueued in the meantime, so that they can be handed to the controller once its construction succeeds.
 type errorController struct {
-	informer cache.SharedIndexInformer
+	informer *pendingInformer
+	clock    clock.PassiveClock
+
+	lock sync.Mutex
+	// pending holds the time at which each remembered key is due
+	pending map[string]time.Time
 }
 
-func newErrorController() *errorController {
+func newErrorController(clock clock.PassiveClock) *errorController {
 	return &errorController{
-		informer: cache.NewSharedIndexInformer(nil, nil, 0, cache.Indexers{}),
+		informer: &pendingInformer{placeholder: cache.NewSharedIndexInformer(nil, nil, 0, cache.Indexers{})},
+		clock:    clock,
+		pending:  map[string]time.Time{},
 	}
 }
 
 func (n *errorController) Enqueue(namespace, name string) {
+	n.EnqueueKey(keyFunc(namespace, name))
 }
 
 func (n *errorController) EnqueueAfter(namespace, name string, delay time.Duration) {
+	n.enqueue(keyFunc(namespace, name), delay)
 }
 
 func (n *errorController) EnqueueKey(key string) {
+	n.enqueue(key, 0)
+}
+
+func (n *errorController) enqueue(key string, delay time.Duration) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	due := n.clock.Now().Add(delay)
+	// like the workqueue, the earliest time wins for a key enqueued several times
+	if existing, ok := n.pending[key]; !ok || due.Before(existing) {
+		n.pending[key] = due
+	}
 }
 
 func (n *errorController) Informer() cache.SharedIndexInformer {
@@ -33,3 +61,140 @@ func (n *errorController) Informer() cache.SharedIndexInformer {
 func (n *errorController) Start(ctx context.Context, workers int) error {
 	return nil
 }
+
+// replay enqueues the remembered keys in controller, keys enqueued with a delay are only delayed for the remaining
+// time. The informer handed out in the meantime passes its calls on to the informer of controller from now on.
+func (n *errorController) replay(controller Controller) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.informer.construct(controller.Informer())
+	now := n.clock.Now()
+	for key, due := range n.pending {
+		delay := due.Sub(now)
+		if delay <= 0 {
+			controller.EnqueueKey(key)
+			continue
+		}
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			continue
+		}
+		controller.EnqueueAfter(namespace, name, delay)
+	}
+	n.pending = map[string]time.Time{}
+}
+
+func (n *errorController) pendingKeys() int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return len(n.pending)
+}
+
+// pendingInformer is the informer of an errorController. Callers may keep it before the controller is constructed,
+// so once it is, every call is passed on to the informer of the constructed controller. Until then, registering
+// event handlers, indexers, transforms and watch error handlers fails with errNotConstructed, and the store is
+// empty and never synced.
+type pendingInformer struct {
+	placeholder cache.SharedIndexInformer
+
+	lock     sync.RWMutex
+	informer cache.SharedIndexInformer
+}
+
+func (p *pendingInformer) construct(informer cache.SharedIndexInformer) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.informer = informer
+}
+
+// constructed returns the informer of the constructed controller or nil.
+func (p *pendingInformer) constructed() cache.SharedIndexInformer {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.informer
+}
+
+// current returns the informer of the constructed controller or the placeholder.
+func (p *pendingInformer) current() cache.SharedIndexInformer {
+	if informer := p.constructed(); informer != nil {
+		return informer
+	}
+	return p.placeholder
+}
+
+func (p *pendingInformer) AddEventHandler(handler cache.ResourceEventHandler) (cache.ResourceEventHandlerRegistration, error) {
+	if informer := p.constructed(); informer != nil {
+		return informer.AddEventHandler(handler)
+	}
+	return nil, errNotConstructed
+}
+
+func (p *pendingInformer) AddEventHandlerWithResyncPeriod(handler cache.ResourceEventHandler, resyncPeriod time.Duration) (cache.ResourceEventHandlerRegistration, error) {
+	if informer := p.constructed(); informer != nil {
+		return informer.AddEventHandlerWithResyncPeriod(handler, resyncPeriod)
+	}
+	return nil, errNotConstructed
+}
+
+func (p *pendingInformer) RemoveEventHandler(handle cache.ResourceEventHandlerRegistration) error {
+	if informer := p.constructed(); informer != nil {
+		return informer.RemoveEventHandler(handle)
+	}
+	return errNotConstructed
+}
+
+func (p *pendingInformer) GetStore() cache.Store {
+	return p.current().GetStore()
+}
+
+func (p *pendingInformer) GetController() cache.Controller {
+	return p.current().GetController()
+}
+
+// Run runs the informer of the constructed controller. Before the construction, it blocks until stopCh is closed,
+// the informer of a controller constructed later is run by its cache factory.
+func (p *pendingInformer) Run(stopCh <-chan struct{}) {
+	if informer := p.constructed(); informer != nil {
+		informer.Run(stopCh)
+		return
+	}
+	<-stopCh
+}
+
+func (p *pendingInformer) HasSynced() bool {
+	return p.current().HasSynced()
+}
+
+func (p *pendingInformer) LastSyncResourceVersion() string {
+	return p.current().LastSyncResourceVersion()
+}
+
+func (p *pendingInformer) SetWatchErrorHandler(handler cache.WatchErrorHandler) error {
+	if informer := p.constructed(); informer != nil {
+		return informer.SetWatchErrorHandler(handler)
+	}
+	return errNotConstructed
+}
+
+func (p *pendingInformer) SetTransform(handler cache.TransformFunc) error {
+	if informer := p.constructed(); informer != nil {
+		return informer.SetTransform(handler)
+	}
+	return errNotConstructed
+}
+
+func (p *pendingInformer) IsStopped() bool {
+	return p.current().IsStopped()
+}
+
+func (p *pendingInformer) AddIndexers(indexers cache.Indexers) error {
+	if informer := p.constructed(); informer != nil {
+		return informer.AddIndexers(indexers)
+	}
+	return errNotConstructed
+}
+
+func (p *pendingInformer) GetIndexer() cache.Indexer {
+	return p.current().GetIndexer()
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+type recordingController struct {
+	informer cache.SharedIndexInformer
+
+	lock    sync.Mutex
+	keys    []string
+	delays  map[string]time.Duration
+	started bool
+}
+
+func (r *recordingController) Enqueue(namespace, name string) {
+	r.EnqueueKey(keyFunc(namespace, name))
+}
+
+func (r *recordingController) EnqueueAfter(namespace, name string, delay time.Duration) {
+	r.EnqueueKey(keyFunc(namespace, name))
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.delays == nil {
+		r.delays = map[string]time.Duration{}
+	}
+	r.delays[keyFunc(namespace, name)] = delay
+}
+
+func (r *recordingController) EnqueueKey(key string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.keys = append(r.keys, key)
+}
+
+func (r *recordingController) Informer() cache.SharedIndexInformer {
+	return r.informer
+}
+
+func (r *recordingController) Start(ctx context.Context, workers int) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.started = true
+	return nil
+}
+
+func TestSharedControllerRetriesConstruction(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	constructed := &recordingController{}
+
+	var (
+		lock     sync.Mutex
+		attempts int
+	)
+	sc := &sharedController{
+		deferredController: func() (Controller, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			attempts++
+			if attempts < 3 {
+				return nil, errors.New("no matches for kind")
+			}
+			return constructed, nil
+		},
+		handler: &SharedHandler{controllerGVR: "test"},
+		clock:   fakeClock,
+	}
+
+	sc.Enqueue("ns", "a")
+	sc.EnqueueKey("ns/b")
+	status := sc.ConstructionStatus()
+	assert.False(t, status.Constructed)
+	assert.EqualError(t, status.Err, "no matches for kind")
+	assert.Equal(t, 1, status.FailedAttempts)
+	assert.Equal(t, 2, status.PendingKeys)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the construction error is returned while the construction is retried in the background
+	assert.EqualError(t, sc.Start(ctx, 1), "no matches for kind")
+
+	assert.Eventually(t, func() bool {
+		if fakeClock.HasWaiters() {
+			fakeClock.Step(time.Minute)
+		}
+		return sc.ConstructionStatus().Constructed
+	}, 5*time.Second, time.Millisecond)
+
+	status = sc.ConstructionStatus()
+	assert.NoError(t, status.Err)
+	assert.Equal(t, 2, status.FailedAttempts)
+	assert.Equal(t, 0, status.PendingKeys)
+
+	assert.Eventually(t, func() bool {
+		constructed.lock.Lock()
+		defer constructed.lock.Unlock()
+		return constructed.started
+	}, 5*time.Second, time.Millisecond)
+	constructed.lock.Lock()
+	defer constructed.lock.Unlock()
+	assert.ElementsMatch(t, []string{"ns/a", "ns/b"}, constructed.keys)
+}
+
+func TestErrorControllerReplaysRemainingDelay(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	failed := newErrorController(fakeClock)
+
+	failed.EnqueueAfter("ns", "later", time.Minute)
+	failed.EnqueueAfter("ns", "expired", 10*time.Second)
+	failed.EnqueueKey("ns/now")
+	fakeClock.Step(40 * time.Second)
+
+	constructed := &recordingController{}
+	failed.replay(constructed)
+
+	assert.ElementsMatch(t, []string{"ns/later", "ns/expired", "ns/now"}, constructed.keys)
+	assert.Equal(t, map[string]time.Duration{"ns/later": 20 * time.Second}, constructed.delays)
+	assert.Zero(t, failed.pendingKeys())
+}
+
+func TestErrorControllerInformerPassesThrough(t *testing.T) {
+	failed := newErrorController(clocktesting.NewFakeClock(time.Now()))
+	informer := failed.Informer()
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{})
+	assert.ErrorIs(t, err, errNotConstructed)
+	assert.ErrorIs(t, informer.AddIndexers(cache.Indexers{"test": cache.MetaNamespaceIndexFunc}), errNotConstructed)
+	assert.False(t, informer.HasSynced())
+	assert.Empty(t, informer.GetStore().ListKeys())
+
+	constructed := &recordingController{
+		informer: cache.NewSharedIndexInformer(nil, &corev1.ConfigMap{}, 0, cache.Indexers{}),
+	}
+	assert.NoError(t, constructed.informer.GetStore().Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}))
+	failed.replay(constructed)
+
+	// callers that kept the informer of the failed construction see the informer of the constructed controller
+	assert.Equal(t, []string{"ns/cm"}, informer.GetStore().ListKeys())
+	assert.NoError(t, informer.AddIndexers(cache.Indexers{"test": cache.MetaNamespaceIndexFunc}))
+	assert.Contains(t, constructed.informer.GetIndexer().GetIndexers(), "test")
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/scheme"
+	eventsv1 "k8s.io/api/events/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/utils/lru"
+)
+
+const (
+	// same defaults as the client-go event spam filter, a burst of 25 events per object refilled every 5 minutes
+	defaultEventBurst = 25
+	defaultEventQPS   = 1. / 300.
+	eventRateLimiters = 4096
+	maxEventNoteBytes = 1024
+
+	// HandlerErrorReason is the reason of the events recorded when a handler fails
+	HandlerErrorReason = "HandlerError"
+)
+
+var eventsGVR = eventsv1.SchemeGroupVersion.WithResource("events")
+
+// EventOptions enables the event recorder of a SharedControllerFactory.
+type EventOptions struct {
+	// ReportingController is the name of the controller reported in every event, e.g. "example.com/my-operator".
+	ReportingController string
+	// Scheme is used to find the kind of objects that have no type information. Defaults to scheme.All.
+	Scheme *runtime.Scheme
+	// Burst and QPS limit how many events are recorded per involved object. Default to a burst of 25
+	// and one event every 5 minutes.
+	Burst int
+	QPS   float32
+	// DisableHandlerErrors stops the shared controllers from recording a Warning event when a handler fails.
+	DisableHandlerErrors bool
+}
+
+type eventRecorder struct {
+	broadcaster events.EventBroadcaster
+	recorder    events.EventRecorder
+
+	startLock sync.Mutex
+	started   bool
+
+	lock         sync.Mutex
+	burst        int
+	qps          float32
+	rateLimiters *lru.Cache
+}
+
+func newEventRecorder(client *client.Client, opts EventOptions) *eventRecorder {
+	if opts.Scheme == nil {
+		opts.Scheme = scheme.All
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = defaultEventBurst
+	}
+	if opts.QPS <= 0 {
+		opts.QPS = defaultEventQPS
+	}
+
+	broadcaster := events.NewBroadcaster(&eventSink{client: client})
+	return &eventRecorder{
+		broadcaster:  broadcaster,
+		recorder:     broadcaster.NewRecorder(opts.Scheme, opts.ReportingController),
+		burst:        opts.Burst,
+		qps:          opts.QPS,
+		rateLimiters: lru.New(eventRateLimiters),
+	}
+}
+
+// start begins writing recorded events to the apiserver, events recorded before are dropped.
+func (e *eventRecorder) start(ctx context.Context) error {
+	e.startLock.Lock()
+	defer e.startLock.Unlock()
+
+	if e.started {
+		return nil
+	}
+	if err := e.broadcaster.StartRecordingToSinkWithContext(ctx); err != nil {
+		return err
+	}
+	e.started = true
+	return nil
+}
+
+// Eventf records an event unless the involved object exceeded its event budget. Isomorphic events are
+// aggregated into an event series by the events.k8s.io broadcaster.
+func (e *eventRecorder) Eventf(regarding runtime.Object, related runtime.Object, eventtype, reason, action, note string, args ...interface{}) {
+	if !e.allow(regarding) {
+		return
+	}
+	e.recorder.Eventf(regarding, related, eventtype, reason, action, note, args...)
+}
+
+func (e *eventRecorder) allow(regarding runtime.Object) bool {
+	key := eventKeyFor(regarding)
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	limiter, ok := e.rateLimiters.Get(key)
+	if !ok {
+		limiter = flowcontrol.NewTokenBucketRateLimiter(e.qps, e.burst)
+		e.rateLimiters.Add(key, limiter)
+	}
+	return limiter.(flowcontrol.RateLimiter).TryAccept()
+}
+
+func eventKeyFor(obj runtime.Object) string {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return fmt.Sprintf("%T", obj)
+	}
+	if m.GetUID() != "" {
+		return string(m.GetUID())
+	}
+	return obj.GetObjectKind().GroupVersionKind().String() + "/" + m.GetNamespace() + "/" + m.GetName()
+}
+
+// recordHandlerError records a Warning event for a failed handler on the object it failed on.
+func (e *eventRecorder) recordHandlerError(handlerName string, obj runtime.Object, err error) {
+	note := fmt.Sprintf("handler %s: %v", handlerName, err)
+	if reason := apierrors.ReasonForError(err); reason != metav1.StatusReasonUnknown {
+		note = fmt.Sprintf("handler %s: %s: %v", handlerName, reason, err)
+	}
+	e.Eventf(obj, nil, "Warning", HandlerErrorReason, handlerName, "%s", truncateNote(note))
+}
+
+// truncateNote shortens the note to maxEventNoteBytes without splitting a UTF-8 encoded rune.
+func truncateNote(note string) string {
+	if len(note) <= maxEventNoteBytes {
+		return note
+	}
+	end := maxEventNoteBytes
+	for end > 0 && !utf8.RuneStart(note[end]) {
+		end--
+	}
+	return note[:end]
+}
+
+// eventSink writes events.k8s.io/v1 Events through a lasso client. Events are sent and received as unstructured
+// content so that the Event type does not need to be registered in the client's scheme.
+type eventSink struct {
+	client *client.Client
+}
+
+func (e *eventSink) Create(ctx context.Context, event *eventsv1.Event) (*eventsv1.Event, error) {
+	obj, err := toUnstructuredEvent(event)
+	if err != nil {
+		return nil, err
+	}
+	result := &unstructured.Unstructured{}
+	if err := e.client.Create(ctx, event.Namespace, obj, result, metav1.CreateOptions{}); err != nil {
+		return nil, err
+	}
+	return fromUnstructuredEvent(result)
+}
+
+func (e *eventSink) Update(ctx context.Context, event *eventsv1.Event) (*eventsv1.Event, error) {
+	obj, err := toUnstructuredEvent(event)
+	if err != nil {
+		return nil, err
+	}
+	result := &unstructured.Unstructured{}
+	if err := e.client.Update(ctx, event.Namespace, obj, result, metav1.UpdateOptions{}); err != nil {
+		return nil, err
+	}
+	return fromUnstructuredEvent(result)
+}
+
+func (e *eventSink) Patch(ctx context.Context, event *eventsv1.Event, data []byte) (*eventsv1.Event, error) {
+	if event.Namespace == "" {
+		return nil, fmt.Errorf("can't patch an event with empty namespace")
+	}
+	result := &unstructured.Unstructured{}
+	if err := e.client.Patch(ctx, event.Namespace, event.Name, types.StrategicMergePatchType, data, result, metav1.PatchOptions{}); err != nil {
+		return nil, err
+	}
+	return fromUnstructuredEvent(result)
+}
+
+func toUnstructuredEvent(event *eventsv1.Event) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(event)
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{Object: content}
+	obj.SetGroupVersionKind(eventsv1.SchemeGroupVersion.WithKind("Event"))
+	return obj, nil
+}
+
+func fromUnstructuredEvent(obj *unstructured.Unstructured) (*eventsv1.Event, error) {
+	event := &eventsv1.Event{}
+	return event, runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, event)
+}
+
+// EventRecordingFactory is implemented by the SharedControllerFactory returned by NewSharedControllerFactory.
+type EventRecordingFactory interface {
+	// EventRecorder returns a recorder that writes events.k8s.io/v1 Events through the factory's clients. Events
+	// are only written once the factory is started and if SharedControllerFactoryOptions.Events is set.
+	EventRecorder() events.EventRecorder
+}
+
+// EventRecorderFor returns the event recorder of the factory, or a recorder that drops every event if the factory
+// does not record events.
+func EventRecorderFor(factory SharedControllerFactory) events.EventRecorder {
+	if recording, ok := factory.(EventRecordingFactory); ok {
+		return recording.EventRecorder()
+	}
+	return noopEventRecorder{}
+}
+
+type noopEventRecorder struct{}
+
+func (noopEventRecorder) Eventf(regarding runtime.Object, related runtime.Object, eventtype, reason, action, note string, args ...interface{}) {
+}
@@ -0,0 +1,44 @@
+package controller_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rancher/lasso/pkg/controller"
+	"github.com/rancher/lasso/pkg/fake"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestFactoryRecordsHandlerErrorEvents(t *testing.T) {
+	f, ctx := newTestFactory(t, &fake.Options{
+		ControllerOptions: &controller.SharedControllerFactoryOptions{
+			Events: &controller.EventOptions{ReportingController: "lasso.cattle.io/test"},
+		},
+	}, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "broken", Namespace: "default"},
+	})
+
+	forKind(t, f, configMapGVK).RegisterHandler(ctx, "fail", controller.SharedControllerHandlerFunc(func(key string, obj runtime.Object) (runtime.Object, error) {
+		return obj, errors.New("boom")
+	}))
+
+	require.NoError(t, f.Start(ctx, 1))
+
+	eventGVK := eventsv1.SchemeGroupVersion.WithKind("Event")
+	eventually(t, func() bool {
+		events, err := f.List(eventGVK, "default")
+		if err != nil || len(events) == 0 {
+			return false
+		}
+		event := events[0].(*eventsv1.Event)
+		return event.Reason == controller.HandlerErrorReason &&
+			event.Type == corev1.EventTypeWarning &&
+			event.Action == "fail" &&
+			event.Regarding.Name == "broken" &&
+			event.ReportingController == "lasso.cattle.io/test"
+	})
+}
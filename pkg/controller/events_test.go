@@ -0,0 +1,22 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateNote(t *testing.T) {
+	assert.Equal(t, "short", truncateNote("short"))
+
+	ascii := strings.Repeat("a", maxEventNoteBytes+10)
+	assert.Equal(t, ascii[:maxEventNoteBytes], truncateNote(ascii))
+
+	// the rune spanning the limit is dropped as a whole
+	multiByte := strings.Repeat("a", maxEventNoteBytes-1) + "é"
+	truncated := truncateNote(multiByte)
+	assert.True(t, utf8.ValidString(truncated))
+	assert.Equal(t, multiByte[:maxEventNoteBytes-1], truncated)
+}
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"github.com/rancher/lasso/pkg/metrics"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// defaultMaxNamespaceMetrics bounds how many namespaces get their own depth series per controller,
+	// the depth of every other namespace is reported under a single aggregated series
+	defaultMaxNamespaceMetrics = 25
+	otherNamespacesLabel       = "_other"
+	clusterScopedLabel         = "_cluster"
+)
+
+// NamespaceWeightFunc returns how many items are taken from a namespace's sub-queue each time the
+// workers visit it. Values lower than 1 are treated as 1.
+type NamespaceWeightFunc func(namespace string) int
+
+// namespaceFairQueue implements workqueue.Queue by keeping one FIFO per namespace and handing items
+// out in a (weighted) round-robin across the namespaces that have work. Deduplication, the processing
+// set and rate limiting stay in the workqueue that wraps it, which always calls into this type while
+// holding its own lock.
+type namespaceFairQueue struct {
+	controllerName string
+	weight         NamespaceWeightFunc
+	maxMetrics     int
+
+	queues map[string]*namespaceQueue
+	// ring holds the namespaces that currently have items, in visiting order
+	ring    []string
+	next    int
+	credits int
+	length  int
+
+	metricLabels map[string]string
+	otherDepth   int
+}
+
+type namespaceQueue struct {
+	items []interface{}
+}
+
+func newNamespaceFairQueue(controllerName string, weight NamespaceWeightFunc, maxMetrics int) *namespaceFairQueue {
+	if maxMetrics <= 0 {
+		maxMetrics = defaultMaxNamespaceMetrics
+	}
+	return &namespaceFairQueue{
+		controllerName: controllerName,
+		weight:         weight,
+		maxMetrics:     maxMetrics,
+		queues:         map[string]*namespaceQueue{},
+		metricLabels:   map[string]string{},
+	}
+}
+
+func (q *namespaceFairQueue) Touch(item interface{}) {}
+
+func (q *namespaceFairQueue) Push(item interface{}) {
+	namespace := itemNamespace(item)
+
+	nsQueue, ok := q.queues[namespace]
+	if !ok {
+		nsQueue = &namespaceQueue{}
+		q.queues[namespace] = nsQueue
+		q.ring = append(q.ring, namespace)
+	}
+	nsQueue.items = append(nsQueue.items, item)
+	q.length++
+	q.reportDepth(namespace, 1)
+}
+
+func (q *namespaceFairQueue) Len() int {
+	return q.length
+}
+
+func (q *namespaceFairQueue) Pop() interface{} {
+	if q.next >= len(q.ring) {
+		q.next = 0
+	}
+	if q.credits <= 0 {
+		q.credits = q.weightFor(q.ring[q.next])
+	}
+
+	namespace := q.ring[q.next]
+	nsQueue := q.queues[namespace]
+
+	item := nsQueue.items[0]
+	nsQueue.items[0] = nil
+	nsQueue.items = nsQueue.items[1:]
+	q.length--
+	q.credits--
+	q.reportDepth(namespace, -1)
+
+	if len(nsQueue.items) == 0 {
+		// drop the namespace from the ring, the next namespace slides into the current position
+		delete(q.queues, namespace)
+		q.ring = append(q.ring[:q.next], q.ring[q.next+1:]...)
+		q.credits = 0
+	} else if q.credits <= 0 {
+		q.next++
+	}
+
+	return item
+}
+
+func (q *namespaceFairQueue) weightFor(namespace string) int {
+	if q.weight == nil {
+		return 1
+	}
+	if w := q.weight(namespace); w > 0 {
+		return w
+	}
+	return 1
+}
+
+// reportDepth keeps at most maxMetrics namespaces labelled individually. The choice is made when a
+// namespace's sub-queue is created and a namespace releases its label as soon as the sub-queue drains,
+// so that busy namespaces can take the slot over.
+func (q *namespaceFairQueue) reportDepth(namespace string, delta int) {
+	if !metrics.Enabled() {
+		return
+	}
+
+	depth := 0
+	if nsQueue, exists := q.queues[namespace]; exists {
+		depth = len(nsQueue.items)
+	}
+
+	label, ok := q.metricLabels[namespace]
+	if !ok && delta > 0 && depth == 1 && len(q.metricLabels) < q.maxMetrics {
+		label = namespace
+		if label == "" {
+			label = clusterScopedLabel
+		}
+		q.metricLabels[namespace] = label
+		ok = true
+	}
+
+	if !ok {
+		q.otherDepth += delta
+		metrics.SetNamespaceQueueDepth(q.controllerName, otherNamespacesLabel, q.otherDepth)
+		return
+	}
+
+	if depth == 0 {
+		delete(q.metricLabels, namespace)
+		metrics.DelNamespaceQueueDepth(q.controllerName, label)
+		return
+	}
+	metrics.SetNamespaceQueueDepth(q.controllerName, label, depth)
+}
+
+func itemNamespace(item interface{}) string {
+	key, ok := item.(string)
+	if !ok {
+		return ""
+	}
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return ""
+	}
+	return namespace
+}
+
+var _ workqueue.Queue[interface{}] = (*namespaceFairQueue)(nil)
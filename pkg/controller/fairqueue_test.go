@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rancher/lasso/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func drain(q workqueue.Queue[interface{}]) []interface{} {
+	var result []interface{}
+	for q.Len() > 0 {
+		result = append(result, q.Pop())
+	}
+	return result
+}
+
+func TestNamespaceFairQueueRoundRobin(t *testing.T) {
+	q := newNamespaceFairQueue("test", nil, 0)
+	for _, key := range []string{"a/1", "a/2", "a/3", "b/1", "cluster-obj", "b/2"} {
+		q.Push(key)
+	}
+
+	assert.Equal(t, []interface{}{"a/1", "b/1", "cluster-obj", "a/2", "b/2", "a/3"}, drain(q))
+	assert.Empty(t, q.queues)
+	assert.Empty(t, q.ring)
+}
+
+func TestNamespaceFairQueueWeighted(t *testing.T) {
+	q := newNamespaceFairQueue("test", func(namespace string) int {
+		if namespace == "a" {
+			return 2
+		}
+		return 0
+	}, 0)
+	for _, key := range []string{"a/1", "a/2", "a/3", "a/4", "b/1", "b/2"} {
+		q.Push(key)
+	}
+
+	assert.Equal(t, []interface{}{"a/1", "a/2", "b/1", "a/3", "a/4", "b/2"}, drain(q))
+}
+
+func TestNamespaceFairQueueKeepsDedup(t *testing.T) {
+	queue := workqueue.NewWithConfig(workqueue.QueueConfig{
+		Queue: newNamespaceFairQueue("test", nil, 0),
+	})
+	defer queue.ShutDown()
+
+	queue.Add("a/1")
+	queue.Add("a/1")
+	queue.Add("b/1")
+	assert.Equal(t, 2, queue.Len())
+
+	item, _ := queue.Get()
+	assert.Equal(t, "a/1", item)
+	// re-adding an item that is processing must only requeue it once it is done
+	queue.Add("a/1")
+	assert.Equal(t, 1, queue.Len())
+	queue.Done(item)
+	assert.Equal(t, 2, queue.Len())
+}
+
+func TestNamespaceFairQueueMetricsCardinality(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	metrics.MustRegister(reg)
+
+	q := newNamespaceFairQueue("test", nil, 2)
+	for _, key := range []string{"a/1", "a/2", "b/1", "c/1", "d/1", "d/2"} {
+		q.Push(key)
+	}
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP lasso_controller_namespace_queue_depth Current depth of the per-namespace workqueues of controllers with namespace fairness enabled
+# TYPE lasso_controller_namespace_queue_depth gauge
+lasso_controller_namespace_queue_depth{controller_name="test",namespace="_other"} 3
+lasso_controller_namespace_queue_depth{controller_name="test",namespace="a"} 2
+lasso_controller_namespace_queue_depth{controller_name="test",namespace="b"} 1
+`), "lasso_controller_namespace_queue_depth"))
+
+	drain(q)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP lasso_controller_namespace_queue_depth Current depth of the per-namespace workqueues of controllers with namespace fairness enabled
+# TYPE lasso_controller_namespace_queue_depth gauge
+lasso_controller_namespace_queue_depth{controller_name="test",namespace="_other"} 0
+`), "lasso_controller_namespace_queue_depth"))
+}
@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/rancher/lasso/pkg/health"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const defaultLivenessThreshold = 5 * time.Minute
+
+// HealthCheckingFactory is implemented by the SharedControllerFactory returned by NewSharedControllerFactory.
+type HealthCheckingFactory interface {
+	// Readyz returns a handler that reports whether the apiserver is reachable, every cache synced and every
+	// controller in use started with workers.
+	Readyz() http.Handler
+	// Livez returns a handler that reports whether the workers of every controller make progress, see
+	// SharedControllerFactoryOptions.LivenessThreshold.
+	Livez() http.Handler
+}
+
+// ReadyzFor returns the readyz handler of the factory, or a handler without checks if the factory does not report
+// its health.
+func ReadyzFor(factory SharedControllerFactory) http.Handler {
+	if checking, ok := factory.(HealthCheckingFactory); ok {
+		return checking.Readyz()
+	}
+	return health.NewHandler("readyz", noChecks)
+}
+
+// LivezFor returns the livez handler of the factory, or a handler without checks if the factory does not report
+// its health.
+func LivezFor(factory SharedControllerFactory) http.Handler {
+	if checking, ok := factory.(HealthCheckingFactory); ok {
+		return checking.Livez()
+	}
+	return health.NewHandler("livez", noChecks)
+}
+
+func noChecks() []health.Check {
+	return nil
+}
+
+// healthChecker is implemented by controllers that report their readiness and liveness.
+type healthChecker interface {
+	// readyCheck fails until the controller was started with workers.
+	readyCheck() error
+	// liveCheck fails if the controller has work but its workers did not pick up or finish a key within threshold.
+	liveCheck(threshold time.Duration) error
+}
+
+// trackProgress marks a worker as busy with a key and returns the func marking it as done. Picking up and
+// finishing a key both count as progress for the liveness check.
+func (c *controller) trackProgress() func() {
+	c.progressLock.Lock()
+	defer c.progressLock.Unlock()
+
+	if c.inFlight == nil {
+		c.inFlight = map[int64]time.Time{}
+	}
+	id := c.nextInFlight
+	c.nextInFlight++
+	c.lastProgress = c.clock.Now()
+	c.inFlight[id] = c.lastProgress
+
+	return func() {
+		c.progressLock.Lock()
+		defer c.progressLock.Unlock()
+		delete(c.inFlight, id)
+		c.lastProgress = c.clock.Now()
+	}
+}
+
+func (c *controller) readyCheck() error {
+	c.startLock.Lock()
+	defer c.startLock.Unlock()
+
+	if !c.started {
+		return errors.New("not started")
+	}
+	if !c.synchronous && c.workers <= 0 {
+		return errors.New("started without workers")
+	}
+	return nil
+}
+
+func (c *controller) liveCheck(threshold time.Duration) error {
+	c.startLock.Lock()
+	queue, started := c.workqueue, c.started
+	c.startLock.Unlock()
+
+	// synchronous controllers make progress when the caller processes their keys
+	if !started || queue == nil || c.synchronous {
+		return nil
+	}
+
+	now := c.clock.Now()
+	c.progressLock.Lock()
+	lastProgress := c.lastProgress
+	var oldest time.Time
+	for _, pickedUp := range c.inFlight {
+		if oldest.IsZero() || pickedUp.Before(oldest) {
+			oldest = pickedUp
+		}
+	}
+	c.progressLock.Unlock()
+
+	// a stuck worker is reported even if the other workers make progress
+	if busy := now.Sub(oldest); !oldest.IsZero() && busy > threshold {
+		return fmt.Errorf("a worker is busy with a key for %s", busy.Round(time.Second))
+	}
+	if queued := queue.Len(); queued > 0 {
+		if since := now.Sub(lastProgress); since > threshold {
+			return fmt.Errorf("%d keys queued without progress for %s", queued, since.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+func (s *sharedController) readyCheck() error {
+	s.startLock.Lock()
+	defer s.startLock.Unlock()
+
+	if s.startError != nil {
+		return s.startError
+	}
+	if !s.started {
+		return errors.New("not started")
+	}
+	if c, ok := s.controller.(healthChecker); ok {
+		return c.readyCheck()
+	}
+	return nil
+}
+
+func (s *sharedController) liveCheck(threshold time.Duration) error {
+	s.startLock.Lock()
+	c, ok := s.controller.(healthChecker)
+	s.startLock.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return c.liveCheck(threshold)
+}
+
+// inUse reports whether the controller was initialized, shared controllers that were only used for their client
+// are never started and not part of the health checks.
+func (s *sharedController) inUse() bool {
+	s.startLock.Lock()
+	defer s.startLock.Unlock()
+	return s.controller != nil
+}
+
+func (s *sharedControllerFactory) Readyz() http.Handler {
+	return health.NewHandler("readyz", s.readyChecks)
+}
+
+func (s *sharedControllerFactory) Livez() http.Handler {
+	return health.NewHandler("livez", s.liveChecks)
+}
+
+func (s *sharedControllerFactory) readyChecks() []health.Check {
+	checks := []health.Check{
+		health.NamedCheck("apiserver", func(ctx context.Context) error {
+			if !s.sharedCacheFactory.SharedClientFactory().IsHealthy(ctx) {
+				return errors.New("apiserver is not reachable")
+			}
+			return nil
+		}),
+	}
+
+	var synced map[schema.GroupVersionKind]bool
+	if reporter, ok := s.sharedCacheFactory.(cache.SyncReporter); ok {
+		synced = reporter.HasSynced()
+	}
+	for gvk, synced := range synced {
+		name := strings.TrimSuffix(gvk.Kind+"."+gvk.Version+"."+gvk.Group, ".")
+		checks = append(checks, health.NamedCheck("cache:"+name, func(context.Context) error {
+			if !synced {
+				return errors.New("not synced")
+			}
+			return nil
+		}))
+	}
+
+	for name, c := range s.controllersInUse() {
+		checks = append(checks, health.NamedCheck("controller:"+name, func(context.Context) error {
+			return c.readyCheck()
+		}))
+	}
+	return checks
+}
+
+func (s *sharedControllerFactory) liveChecks() []health.Check {
+	var checks []health.Check
+	for name, c := range s.controllersInUse() {
+		checks = append(checks, health.NamedCheck("controller:"+name, func(context.Context) error {
+			return c.liveCheck(s.livenessThreshold)
+		}))
+	}
+	return checks
+}
+
+func (s *sharedControllerFactory) controllersInUse() map[string]*sharedController {
+	s.controllerLock.RLock()
+	defer s.controllerLock.RUnlock()
+
+	controllers := map[string]*sharedController{}
+	for key, c := range s.controllers {
+		if c.inUse() {
+			name := strings.TrimSuffix(key.gvr.Resource+"."+key.gvr.Version+"."+key.gvr.Group, ".")
+			controllers[s.controllerName(scopedName(name, key.scope))] = c
+		}
+	}
+	return controllers
+}
@@ -0,0 +1,40 @@
+package controller_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rancher/lasso/pkg/controller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestFactoryHealth(t *testing.T) {
+	f, ctx := newTestFactory(t, nil)
+
+	forKind(t, f, configMapGVK).RegisterHandler(ctx, "noop", controller.SharedControllerHandlerFunc(func(key string, obj runtime.Object) (runtime.Object, error) {
+		return obj, nil
+	}))
+
+	get := func(handler http.Handler) (int, string) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?verbose", nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	code, body := get(f.Readyz())
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, body, "[-]controller:configmaps.v1 failed: not started\n")
+
+	require.NoError(t, f.Start(ctx, 1))
+
+	code, body = get(f.Readyz())
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "[+]apiserver ok\n[+]cache:ConfigMap.v1 ok\n[+]controller:configmaps.v1 ok\nreadyz check passed\n", body)
+
+	code, body = get(f.Livez())
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "[+]controller:configmaps.v1 ok\nlivez check passed\n", body)
+}
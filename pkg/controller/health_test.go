@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/workqueue"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestControllerLiveCheck(t *testing.T) {
+	informer := newTestInformer(
+		corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "stuck", Namespace: "ns"}},
+		corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "quick", Namespace: "ns"}},
+	)
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+
+	var quick atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	c := New("live-check-test", informer, func(ctx context.Context) error {
+		go informer.Run(ctx.Done())
+		return nil
+	}, HandlerFunc(func(key string, obj runtime.Object) error {
+		if key == "ns/quick" {
+			quick.Add(1)
+			return nil
+		}
+		close(started)
+		<-release
+		return nil
+	}), &Options{
+		// keys are enqueued without delay, which the fake clock would hold back
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(0, 0),
+		Clock:       fakeClock,
+	}).(*controller)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.EqualError(t, c.readyCheck(), "not started")
+	require.NoError(t, c.Start(ctx, 2))
+	require.NoError(t, c.readyCheck())
+
+	<-started
+	require.NoError(t, c.liveCheck(time.Minute))
+	fakeClock.Step(2 * time.Minute)
+
+	// the other worker keeps making progress, which must not hide the stuck one
+	handled := quick.Load()
+	c.Enqueue("ns", "quick")
+	assert.Eventually(t, func() bool {
+		return quick.Load() > handled
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.EqualError(t, c.liveCheck(time.Minute), "a worker is busy with a key for 2m0s")
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return c.liveCheck(time.Minute) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,16 @@
+package controller
+
+import (
+	"github.com/rancher/lasso/pkg/cache"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// NewLister returns a lister reading the objects of type T from the cache of the shared controller.
+func NewLister[T runtime.Object](controller SharedController, opts *cache.ListerOptions) *cache.Lister[T] {
+	var resource schema.GroupResource
+	if client := controller.Client(); client != nil {
+		resource = client.GVR.GroupResource()
+	}
+	return cache.NewLister[T](controller.Informer(), resource, opts)
+}
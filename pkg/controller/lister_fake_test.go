@@ -0,0 +1,32 @@
+package controller_test
+
+import (
+	"testing"
+
+	"github.com/rancher/lasso/pkg/controller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgocache "k8s.io/client-go/tools/cache"
+)
+
+func TestFactoryListers(t *testing.T) {
+	f, ctx := newTestFactory(t, nil,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}},
+	)
+
+	configMaps := forKind(t, f, configMapGVK)
+	lister := controller.NewLister[*corev1.ConfigMap](configMaps, nil)
+	require.NoError(t, f.Start(ctx, 1))
+	require.True(t, clientgocache.WaitForCacheSync(ctx.Done(), configMaps.Informer().HasSynced))
+
+	cm, err := lister.Get("default", "cm")
+	require.NoError(t, err)
+	assert.Equal(t, "cm", cm.Name)
+
+	_, err = lister.Get("default", "missing")
+	assert.True(t, apierrors.IsNotFound(err))
+	assert.ErrorContains(t, err, `configmaps "missing" not found`)
+}
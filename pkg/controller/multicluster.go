@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/log"
+	"github.com/rancher/lasso/pkg/metrics"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// ClusterHandler is registered once with a MultiClusterFactory and called for the keys of every cluster.
+type ClusterHandler interface {
+	OnChange(cluster, key string, obj runtime.Object) (runtime.Object, error)
+}
+
+type ClusterHandlerFunc func(cluster, key string, obj runtime.Object) (runtime.Object, error)
+
+func (c ClusterHandlerFunc) OnChange(cluster, key string, obj runtime.Object) (runtime.Object, error) {
+	return c(cluster, key, obj)
+}
+
+// MultiClusterFactory manages one SharedControllerFactory per cluster. Clusters can be added and removed at
+// runtime, handlers are registered once for all clusters.
+//
+// Handler and cache metrics are labelled with the cluster name. The client request budget metrics, see
+// metrics.ReportClientThrottleTime, have no cluster label, so the throttling of all clusters is summed in the same
+// series. The clients of the clusters are created without request budgets, this only applies to clients with
+// budgets created for the clusters outside of the MultiClusterFactory.
+type MultiClusterFactory interface {
+	// AddCluster creates the factory of a cluster and registers the existing handlers with it. If the
+	// MultiClusterFactory is started, the cluster is started in the background.
+	AddCluster(name string, config *rest.Config) error
+	// RemoveCluster stops the informers and controllers of a cluster.
+	RemoveCluster(name string)
+	// Cluster returns the factory of a cluster.
+	Cluster(name string) (SharedControllerFactory, bool)
+	// Clusters returns the names of the added clusters.
+	Clusters() []string
+	// RegisterHandler registers handler for the kind with every current and future cluster until ctx is done.
+	RegisterHandler(ctx context.Context, gvk schema.GroupVersionKind, name string, handler ClusterHandler)
+	// Start starts every cluster, clusters added later are started when added. All clusters are stopped
+	// when ctx is done.
+	Start(ctx context.Context, workers int) error
+}
+
+type MultiClusterFactoryOptions struct {
+	// Scheme is used for the clients of every cluster.
+	Scheme *runtime.Scheme
+	// Mapper is used for every cluster instead of discovering the resources of each cluster.
+	Mapper meta.RESTMapper
+	// ControllerOptions are used for the factory of every cluster. Name is replaced by the cluster name, so that
+	// controllers, handler metrics and cache metrics are labelled per cluster.
+	ControllerOptions *SharedControllerFactoryOptions
+}
+
+type cluster struct {
+	name    string
+	factory SharedControllerFactory
+	ctx     context.Context
+	cancel  context.CancelFunc
+	// kinds are the kinds that have handlers in the cluster, guarded by the lock of the multiClusterFactory
+	kinds map[schema.GroupVersionKind]bool
+}
+
+type clusterRegistration struct {
+	ctx     context.Context
+	gvk     schema.GroupVersionKind
+	name    string
+	handler ClusterHandler
+}
+
+type multiClusterFactory struct {
+	lock sync.Mutex
+
+	scheme *runtime.Scheme
+	mapper meta.RESTMapper
+	opts   SharedControllerFactoryOptions
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	clusters      map[string]*cluster
+	registrations []*clusterRegistration
+	started       bool
+	workers       int
+}
+
+func NewMultiClusterFactory(opts *MultiClusterFactoryOptions) MultiClusterFactory {
+	var newOpts MultiClusterFactoryOptions
+	if opts != nil {
+		newOpts = *opts
+	}
+
+	m := &multiClusterFactory{
+		scheme:   newOpts.Scheme,
+		mapper:   newOpts.Mapper,
+		clusters: map[string]*cluster{},
+	}
+	if newOpts.ControllerOptions != nil {
+		m.opts = *newOpts.ControllerOptions
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m
+}
+
+func (m *multiClusterFactory) AddCluster(name string, config *rest.Config) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.clusters[name]; ok {
+		return fmt.Errorf("cluster %s already exists", name)
+	}
+
+	opts := m.opts
+	opts.Name = name
+	clientFactory, err := client.NewSharedClientFactory(config, &client.SharedClientFactoryOptions{
+		Mapper: m.mapper,
+		Scheme: m.scheme,
+	})
+	if err != nil {
+		return fmt.Errorf("creating clients for cluster %s: %w", name, err)
+	}
+
+	c := &cluster{
+		name:    name,
+		factory: NewSharedControllerFactory(cache.NewSharedCachedFactory(clientFactory, opts.CacheOptions), &opts),
+		kinds:   map[schema.GroupVersionKind]bool{},
+	}
+	c.ctx, c.cancel = context.WithCancel(metrics.WithContextID(m.ctx, name))
+	m.clusters[name] = c
+
+	for _, registration := range m.registrations {
+		c.register(registration)
+	}
+	if m.started {
+		c.start(m.workers)
+	}
+	return nil
+}
+
+func (m *multiClusterFactory) RemoveCluster(name string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if c, ok := m.clusters[name]; ok {
+		c.cancel()
+		delete(m.clusters, name)
+	}
+}
+
+func (m *multiClusterFactory) Cluster(name string) (SharedControllerFactory, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	c, ok := m.clusters[name]
+	if !ok {
+		return nil, false
+	}
+	return c.factory, true
+}
+
+func (m *multiClusterFactory) Clusters() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	names := make([]string, 0, len(m.clusters))
+	for name := range m.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *multiClusterFactory) RegisterHandler(ctx context.Context, gvk schema.GroupVersionKind, name string, handler ClusterHandler) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	registration := &clusterRegistration{
+		ctx:     ctx,
+		gvk:     gvk,
+		name:    name,
+		handler: handler,
+	}
+	m.registrations = append(m.registrations, registration)
+	for _, c := range m.clusters {
+		if controller, added := c.register(registration); added && m.started {
+			// the cluster is running, only the controller of the new kind is started
+			c.startController(controller, m.workers)
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		for i := range m.registrations {
+			if m.registrations[i] == registration {
+				m.registrations = append(m.registrations[:i], m.registrations[i+1:]...)
+				break
+			}
+		}
+	}()
+}
+
+func (m *multiClusterFactory) Start(ctx context.Context, workers int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.started {
+		return nil
+	}
+	m.started = true
+	m.workers = workers
+
+	context.AfterFunc(ctx, m.cancel)
+	for _, c := range m.clusters {
+		c.start(workers)
+	}
+	return nil
+}
+
+// register registers the handler with the cluster until either the registration or the cluster is stopped. It
+// returns the shared controller of the kind and whether it is the first kind's handler in the cluster.
+func (c *cluster) register(registration *clusterRegistration) (SharedController, bool) {
+	sharedController, err := c.factory.ForKind(registration.gvk)
+	if err != nil {
+		log.Errorf("failed to register handler %s for %s in cluster %s: %v", registration.name, registration.gvk, c.name, err)
+		return nil, false
+	}
+	added := !c.kinds[registration.gvk]
+	c.kinds[registration.gvk] = true
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	context.AfterFunc(registration.ctx, cancel)
+
+	clusterName := c.name
+	sharedController.RegisterHandler(ctx, registration.name, SharedControllerHandlerFunc(func(key string, obj runtime.Object) (runtime.Object, error) {
+		return registration.handler.OnChange(clusterName, key, obj)
+	}))
+	return sharedController, added
+}
+
+// start starts the cluster in the background, so that an unreachable cluster does not block the others while
+// its caches sync.
+func (c *cluster) start(workers int) {
+	go func() {
+		if err := c.factory.Start(c.ctx, workers); err != nil {
+			log.Errorf("failed to start cluster %s: %v", c.name, err)
+		}
+	}()
+}
+
+// startController starts a controller of the running cluster in the background.
+func (c *cluster) startController(controller SharedController, workers int) {
+	go func() {
+		if err := controller.Start(c.ctx, workers); err != nil {
+			log.Errorf("failed to start controller in cluster %s: %v", c.name, err)
+		}
+	}()
+}
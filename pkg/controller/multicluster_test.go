@@ -0,0 +1,90 @@
+package controller_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/rancher/lasso/pkg/controller"
+	"github.com/rancher/lasso/pkg/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestMultiClusterFactory(t *testing.T) {
+	clusters := map[string]*fake.Factory{}
+	for _, name := range []string{"a", "b"} {
+		clusters[name], _ = newTestFactory(t, nil,
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm-" + name, Namespace: "default"}},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret-" + name, Namespace: "default"}},
+		)
+	}
+
+	m := controller.NewMultiClusterFactory(&controller.MultiClusterFactoryOptions{
+		Scheme: clusters["a"].Scheme(),
+		Mapper: clusters["a"].RESTMapper(),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		lock sync.Mutex
+		seen = map[string]bool{}
+	)
+	record := controller.ClusterHandlerFunc(func(cluster, key string, obj runtime.Object) (runtime.Object, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		seen[cluster+":"+key] = true
+		return obj, nil
+	})
+	hasSeen := func(keys ...string) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, key := range keys {
+			if !seen[key] {
+				return false
+			}
+		}
+		return true
+	}
+
+	require.NoError(t, m.AddCluster("a", clusters["a"].RESTConfig()))
+	m.RegisterHandler(ctx, configMapGVK, "record", record)
+	require.NoError(t, m.Start(ctx, 1))
+	require.NoError(t, m.AddCluster("b", clusters["b"].RESTConfig()))
+	assert.Error(t, m.AddCluster("b", clusters["b"].RESTConfig()))
+	assert.Equal(t, []string{"a", "b"}, m.Clusters())
+
+	eventually(t, func() bool {
+		return hasSeen("a:default/cm-a", "b:default/cm-b")
+	})
+	assert.False(t, hasSeen("a:default/cm-b"))
+
+	// handlers of a new kind start their controllers in the running clusters
+	secretGVK := corev1.SchemeGroupVersion.WithKind("Secret")
+	m.RegisterHandler(ctx, secretGVK, "record", record)
+	eventually(t, func() bool {
+		return hasSeen("a:default/secret-a", "b:default/secret-b")
+	})
+
+	m.RemoveCluster("a")
+	_, ok := m.Cluster("a")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"b"}, m.Clusters())
+
+	// the informers of the removed cluster stop watching
+	for _, gvk := range []schema.GroupVersionKind{configMapGVK, secretGVK} {
+		eventually(t, func() bool {
+			watches, err := clusters["a"].Watches(gvk)
+			return err == nil && watches == 0
+		}, gvk.Kind)
+		watches, err := clusters["b"].Watches(gvk)
+		require.NoError(t, err)
+		assert.Equal(t, 1, watches, gvk.Kind)
+	}
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/rancher/lasso/pkg/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
+)
+
+type queuedKey struct {
+	item  interface{}
+	added time.Time
+}
+
+// instrumentedQueue wraps the queue of a controller to report how long keys wait before a worker gets them
+// and the age of the oldest waiting key. Push and Pop are called under the workqueue's lock, the own lock
+// guards against concurrent metric collection.
+type instrumentedQueue struct {
+	workqueue.Queue[interface{}]
+
+	name  string
+	clock clock.PassiveClock
+
+	lock sync.Mutex
+	// order holds the waiting keys in the order they were pushed, queues with namespace fairness pop them in
+	// a different order
+	order *list.List
+	added map[interface{}]*list.Element
+}
+
+func newInstrumentedQueue(name string, queue workqueue.Queue[interface{}], clock clock.PassiveClock) *instrumentedQueue {
+	return &instrumentedQueue{
+		Queue: queue,
+		name:  name,
+		clock: clock,
+		order: list.New(),
+		added: map[interface{}]*list.Element{},
+	}
+}
+
+func (q *instrumentedQueue) Push(item interface{}) {
+	q.Queue.Push(item)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	// the workqueue does not push keys that are already waiting
+	if _, ok := q.added[item]; !ok {
+		q.added[item] = q.order.PushBack(queuedKey{item: item, added: q.clock.Now()})
+	}
+}
+
+func (q *instrumentedQueue) Pop() interface{} {
+	item := q.Queue.Pop()
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if element, ok := q.added[item]; ok {
+		delete(q.added, item)
+		q.order.Remove(element)
+		metrics.ReportQueueWaitTime(q.name, q.clock.Since(element.Value.(queuedKey).added).Seconds())
+	}
+	return item
+}
+
+// oldest returns the age of the oldest key in the queue.
+func (q *instrumentedQueue) oldest() time.Duration {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if first := q.order.Front(); first != nil {
+		return q.clock.Since(first.Value.(queuedKey).added)
+	}
+	return 0
+}
+
+// instrumentedRateLimiter tracks the keys of a controller that are in rate-limited backoff, from the time they
+// are added with a rate limit until they are forgotten after a successful sync.
+type instrumentedRateLimiter struct {
+	workqueue.RateLimiter
+
+	name string
+
+	lock    sync.Mutex
+	backoff map[interface{}]struct{}
+}
+
+func newInstrumentedRateLimiter(name string, rateLimiter workqueue.RateLimiter) *instrumentedRateLimiter {
+	metrics.SetRateLimitedKeys(name, 0)
+	return &instrumentedRateLimiter{
+		RateLimiter: rateLimiter,
+		name:        name,
+		backoff:     map[interface{}]struct{}{},
+	}
+}
+
+func (r *instrumentedRateLimiter) When(item interface{}) time.Duration {
+	r.lock.Lock()
+	r.backoff[item] = struct{}{}
+	metrics.SetRateLimitedKeys(r.name, len(r.backoff))
+	r.lock.Unlock()
+
+	return r.RateLimiter.When(item)
+}
+
+func (r *instrumentedRateLimiter) Forget(item interface{}) {
+	r.lock.Lock()
+	delete(r.backoff, item)
+	metrics.SetRateLimitedKeys(r.name, len(r.backoff))
+	r.lock.Unlock()
+
+	r.RateLimiter.Forget(item)
+}
+
+// errorReason classifies handler errors for the handler error metric.
+func errorReason(err error) string {
+	switch {
+	case apierrors.IsConflict(err):
+		return "conflict"
+	case apierrors.IsNotFound(err):
+		return "not_found"
+	case apierrors.IsForbidden(err):
+		return "forbidden"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rancher/lasso/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestInstrumentedQueueOldest(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	q := newInstrumentedQueue("test", workqueue.DefaultQueue[interface{}](), fakeClock)
+
+	assert.Equal(t, time.Duration(0), q.oldest())
+	q.Push("a")
+	fakeClock.Step(time.Second)
+	q.Push("b")
+	fakeClock.Step(2 * time.Second)
+	assert.Equal(t, 3*time.Second, q.oldest())
+
+	assert.Equal(t, "a", q.Pop())
+	assert.Equal(t, 2*time.Second, q.oldest())
+	assert.Equal(t, "b", q.Pop())
+	assert.Equal(t, time.Duration(0), q.oldest())
+
+	// popped keys do not stay behind in the queue order
+	for i := 0; i < 100; i++ {
+		q.Push(i)
+		q.Pop()
+	}
+	assert.Zero(t, q.order.Len())
+	assert.Empty(t, q.added)
+}
+
+func TestControllerMetrics(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	metrics.MustRegister(reg)
+
+	informer := newTestInformer(corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "ns"}})
+	fakeClock := clocktesting.NewFakeClock(time.Unix(1000, 0))
+
+	failures := 0
+	c := New("metrics-test", informer, func(ctx context.Context) error {
+		go informer.Run(ctx.Done())
+		return nil
+	}, HandlerFunc(func(key string, obj runtime.Object) error {
+		if failures < 1 {
+			failures++
+			return errors.New("not yet")
+		}
+		return nil
+	}), &Options{
+		Synchronous: true,
+		Clock:       fakeClock,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, c.Start(ctx, 1))
+	require.NoError(t, c.(SynchronousController).ProcessUntilIdle(ctx))
+
+	// other tests of the package report to the same collectors, only this controller's series are compared
+	assert.NoError(t, testutil.GatherAndCompare(controllerGatherer(reg, "metrics-test"), strings.NewReader(fmt.Sprintf(`
+# HELP lasso_controller_last_successful_reconcile_timestamp_seconds Unix time of the last successful reconciliation per controller
+# TYPE lasso_controller_last_successful_reconcile_timestamp_seconds gauge
+lasso_controller_last_successful_reconcile_timestamp_seconds{controller_name="metrics-test"} %v
+# HELP lasso_controller_rate_limited_keys Current number of keys in rate-limited backoff per controller
+# TYPE lasso_controller_rate_limited_keys gauge
+lasso_controller_rate_limited_keys{controller_name="metrics-test"} 0
+# HELP lasso_controller_oldest_queued_key_seconds Age of the oldest key waiting in the workqueue per controller
+# TYPE lasso_controller_oldest_queued_key_seconds gauge
+lasso_controller_oldest_queued_key_seconds{controller_name="metrics-test"} 0
+`, float64(fakeClock.Now().UnixNano())/float64(time.Second))),
+		"lasso_controller_last_successful_reconcile_timestamp_seconds",
+		"lasso_controller_rate_limited_keys",
+		"lasso_controller_oldest_queued_key_seconds"))
+}
+
+func TestErrorReason(t *testing.T) {
+	assert.Equal(t, "conflict", errorReason(apierrors.NewConflict(schema.GroupResource{}, "a", errors.New("conflict"))))
+	assert.Equal(t, "not_found", errorReason(apierrors.NewNotFound(schema.GroupResource{}, "a")))
+	assert.Equal(t, "forbidden", errorReason(apierrors.NewForbidden(schema.GroupResource{}, "a", errors.New("forbidden"))))
+	assert.Equal(t, "other", errorReason(errors.New("other")))
+}
+
+// controllerGatherer only gathers the series of the given controller.
+func controllerGatherer(reg prometheus.Gatherer, controllerName string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := reg.Gather()
+		for _, family := range families {
+			var metrics []*dto.Metric
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "controller_name" && label.GetValue() == controllerName {
+						metrics = append(metrics, metric)
+					}
+				}
+			}
+			family.Metric = metrics
+		}
+		return families, err
+	})
+}
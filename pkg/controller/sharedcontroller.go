@@ -2,14 +2,25 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/rancher/lasso/pkg/cache"
 	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/log"
+	"github.com/rancher/lasso/pkg/metrics"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
 	cachetools "k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+)
+
+const (
+	constructionRetryInitial = time.Second
+	constructionRetryCap     = 5 * time.Minute
 )
 
 type SharedControllerHandler interface {
@@ -23,6 +34,32 @@ type SharedController interface {
 	Client() *client.Client
 }
 
+// ConstructionReporter is implemented by the shared controllers of the SharedControllerFactory returned by
+// NewSharedControllerFactory.
+type ConstructionReporter interface {
+	// ConstructionStatus reports whether the controller could be constructed.
+	ConstructionStatus() ConstructionStatus
+}
+
+// ConstructionStatus describes the construction of a shared controller. Construction is deferred until the
+// controller is first used and fails for example while the CRD of its type is missing. Once the controller is
+// started, failed constructions are retried with backoff and keys enqueued in the meantime are handed to the
+// controller when construction succeeds, with the remaining time of their delay. The Informer returned while the
+// construction fails passes every call on to the informer of the controller once it is constructed. Until then,
+// adding event handlers, indexers, transforms or watch error handlers to it fails, and its store stays empty.
+type ConstructionStatus struct {
+	// Constructed is true once the controller was constructed.
+	Constructed bool
+	// Err is the error of the last failed construction attempt, nil once constructed.
+	Err error
+	// FailedAttempts counts the failed construction attempts.
+	FailedAttempts int
+	// LastAttempt is the time of the last construction attempt.
+	LastAttempt time.Time
+	// PendingKeys is the number of keys waiting to be enqueued once the controller is constructed.
+	PendingKeys int
+}
+
 type SharedControllerHandlerFunc func(key string, obj runtime.Object) (runtime.Object, error)
 
 func (s SharedControllerHandlerFunc) OnChange(key string, obj runtime.Object) (runtime.Object, error) {
@@ -41,6 +78,13 @@ type sharedController struct {
 	started            bool
 	startError         error
 	client             *client.Client
+	clock              clock.WithTicker
+	// starting counts the Start calls waiting for the controller's cache to sync
+	starting int
+
+	retrying       bool
+	failedAttempts int
+	lastAttempt    time.Time
 }
 
 func (s *sharedController) Enqueue(namespace, name string) {
@@ -71,9 +115,9 @@ func (s *sharedController) initController() Controller {
 		return s.controller
 	}
 
-	controller, err := s.deferredController()
+	controller, err := s.construct()
 	if err != nil {
-		controller = newErrorController()
+		controller = newErrorController(s.clock)
 	}
 
 	s.startError = err
@@ -81,19 +125,121 @@ func (s *sharedController) initController() Controller {
 	return s.controller
 }
 
-func (s *sharedController) Start(ctx context.Context, workers int) error {
+// construct calls deferredController and records the outcome, it must be called with startLock held.
+func (s *sharedController) construct() (Controller, error) {
+	s.lastAttempt = s.clock.Now()
+	controller, err := s.deferredController()
+	if err != nil {
+		s.failedAttempts++
+		log.Errorf("failed to construct controller %s (attempt %d): %v", s.handler.controllerGVR, s.failedAttempts, err)
+	}
+	metrics.SetControllerConstructionFailing(s.handler.controllerGVR, err != nil)
+	return controller, err
+}
+
+// retryConstruction retries the construction of a controller whose construction failed until it succeeds or ctx
+// is done. The new controller replaces the errorController, gets the keys enqueued in the meantime and is
+// started with the given workers.
+func (s *sharedController) retryConstruction(ctx context.Context, workers int) {
+	backoff := wait.Backoff{
+		Duration: constructionRetryInitial,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      constructionRetryCap,
+	}
+
+	for {
+		timer := s.clock.NewTimer(backoff.Step())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.startLock.Lock()
+			s.retrying = false
+			s.startLock.Unlock()
+			return
+		case <-timer.C():
+		}
+
+		if s.retryOnce(ctx, workers) {
+			return
+		}
+	}
+}
+
+func (s *sharedController) retryOnce(ctx context.Context, workers int) bool {
+	s.startLock.Lock()
+	controller, err := s.construct()
+	if err != nil {
+		s.startError = err
+		s.startLock.Unlock()
+		return false
+	}
+
+	if failed, ok := s.controller.(*errorController); ok {
+		failed.replay(controller)
+	}
+	s.controller = controller
+	s.startError = nil
+	s.retrying = false
+	s.startLock.Unlock()
+
+	if err := s.Start(ctx, workers); err != nil && ctx.Err() == nil {
+		log.Errorf("failed to start controller %s: %v", s.handler.controllerGVR, err)
+	}
+	return true
+}
+
+func (s *sharedController) ConstructionStatus() ConstructionStatus {
 	s.startLock.Lock()
 	defer s.startLock.Unlock()
 
-	if s.startError != nil || s.controller == nil {
-		return s.startError
+	status := ConstructionStatus{
+		Constructed:    s.controller != nil && s.startError == nil,
+		Err:            s.startError,
+		FailedAttempts: s.failedAttempts,
+		LastAttempt:    s.lastAttempt,
+	}
+	if failed, ok := s.controller.(*errorController); ok {
+		status.PendingKeys = failed.pendingKeys()
+	}
+	return status
+}
+
+// Start starts the controller. If its construction failed, the construction is retried in the background and the
+// error is returned, the controller starts once it is constructed. The start lock is not held while the controller
+// waits for its cache to sync, so that keys can be enqueued in the meantime.
+func (s *sharedController) Start(ctx context.Context, workers int) error {
+	s.startLock.Lock()
+	if s.controller == nil {
+		s.startLock.Unlock()
+		return nil
+	}
+
+	if s.startError != nil {
+		if !s.retrying {
+			s.retrying = true
+			go s.retryConstruction(ctx, workers)
+		}
+		err := s.startError
+		s.startLock.Unlock()
+		return err
 	}
 
 	if s.started {
+		s.startLock.Unlock()
 		return nil
 	}
+	controller := s.controller
+	s.starting++
+	s.startLock.Unlock()
+
+	err := controller.Start(ctx, workers)
 
-	if err := s.controller.Start(ctx, workers); err != nil {
+	s.startLock.Lock()
+	defer s.startLock.Unlock()
+	s.starting--
+	if err != nil || s.started {
 		return err
 	}
 	s.started = true
@@ -108,6 +254,34 @@ func (s *sharedController) Start(ctx context.Context, workers int) error {
 	return nil
 }
 
+// ProcessUntilIdle implements SynchronousController for shared controllers created by a factory with
+// SharedControllerFactoryOptions.Synchronous.
+func (s *sharedController) ProcessUntilIdle(ctx context.Context) error {
+	c, ok := s.initController().(SynchronousController)
+	if !ok {
+		return fmt.Errorf("shared controller for %s is not synchronous", s.handler.controllerGVR)
+	}
+	return c.ProcessUntilIdle(ctx)
+}
+
+func (s *sharedController) RegisterBatchHandler(ctx context.Context, name string, handler BatchHandler) {
+	// Ensure that controller is initialized
+	c := s.initController()
+
+	getHandlerTransaction(ctx).do(func() {
+		s.handler.RegisterBatch(ctx, name, handler)
+
+		s.startLock.Lock()
+		defer s.startLock.Unlock()
+		// keys of controllers that are still starting are queued until their workers run
+		if s.started || s.starting > 0 {
+			for _, key := range c.Informer().GetStore().ListKeys() {
+				c.EnqueueKey(key)
+			}
+		}
+	})
+}
+
 func (s *sharedController) RegisterHandler(ctx context.Context, name string, handler SharedControllerHandler) {
 	// Ensure that controller is initialized
 	c := s.initController()
@@ -117,7 +291,8 @@ func (s *sharedController) RegisterHandler(ctx context.Context, name string, han
 
 		s.startLock.Lock()
 		defer s.startLock.Unlock()
-		if s.started {
+		// keys of controllers that are still starting are queued until their workers run
+		if s.started || s.starting > 0 {
 			for _, key := range c.Informer().GetStore().ListKeys() {
 				c.EnqueueKey(key)
 			}
@@ -2,15 +2,21 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/rancher/lasso/pkg/cache"
 	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/log"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/events"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
 )
 
 type SharedControllerFactory interface {
@@ -22,14 +28,40 @@ type SharedControllerFactory interface {
 	Start(ctx context.Context, workers int) error
 }
 
+// ScopedControllerFactory is implemented by the SharedControllerFactory returned by NewSharedControllerFactory.
+type ScopedControllerFactory interface {
+	// ForKindScope returns the shared controller of the kind whose cache is restricted to the scope, see
+	// cache.ScopedCacheFactory.
+	ForKindScope(gvk schema.GroupVersionKind, scope cache.Scope) (SharedController, error)
+}
+
+// ForKindScope returns the shared controller of the kind whose cache is restricted to the scope, see
+// ScopedControllerFactory. Factories without scoped controllers only return the controller of the zero Scope.
+func ForKindScope(factory SharedControllerFactory, gvk schema.GroupVersionKind, scope cache.Scope) (SharedController, error) {
+	if scoped, ok := factory.(ScopedControllerFactory); ok {
+		return scoped.ForKindScope(gvk, scope)
+	}
+	if scope != (cache.Scope{}) {
+		return nil, fmt.Errorf("%T does not support scoped controllers, cannot restrict a controller to %s", factory, scope)
+	}
+	return factory.ForKind(gvk)
+}
+
 type SharedControllerFactoryOptions struct {
 	CacheOptions *cache.SharedCacheFactoryOptions
 
+	// Name distinguishes the controllers of several factories running in one process, for example one factory
+	// per cluster. When set, controllers and their metrics are named "<Name>/<controller>".
+	Name string
+
 	DefaultRateLimiter workqueue.RateLimiter
 	DefaultWorkers     int
 
 	KindRateLimiter map[schema.GroupVersionKind]workqueue.RateLimiter
 	KindWorkers     map[schema.GroupVersionKind]int
+	// KindBatch makes the workers of the kinds' shared controllers pick up several keys at once, which are passed
+	// together to the batch handlers registered with SharedBatchController.RegisterBatchHandler.
+	KindBatch map[schema.GroupVersionKind]BatchOptions
 
 	// SyncOnlyChangedObjects causes the handle function to only proceed if the object was actually updated.
 	// This is intended to be used by applications with many objects and/or controllers types that have
@@ -41,20 +73,67 @@ type SharedControllerFactoryOptions struct {
 	// that running the handler func on resync will mostly only serve the purpose of catching missed cache
 	// events.
 	SyncOnlyChangedObjects bool
+
+	// NamespaceFairness enables per-namespace sub-queues with round-robin scheduling for every controller
+	// created by the factory, see Options.NamespaceFairness.
+	NamespaceFairness bool
+	// NamespaceWeight optionally weights the namespace round-robin, see Options.NamespaceWeight.
+	NamespaceWeight NamespaceWeightFunc
+	// MaxNamespaceMetrics bounds the namespaces with their own queue depth series per controller, see
+	// Options.MaxNamespaceMetrics.
+	MaxNamespaceMetrics int
+
+	// Synchronous creates controllers that do not start workers, see Options.Synchronous. The shared controllers
+	// then implement SynchronousController.
+	Synchronous bool
+	// Clock is passed to every controller, see Options.Clock.
+	Clock clock.WithTicker
+
+	// KindStatus opts kinds into automatic status updates. After the handlers ran, the shared controller sets the
+	// Ready, Reconciling and Failed conditions from the handler errors and stamps status.observedGeneration. The
+	// status is only updated if it changed.
+	KindStatus map[schema.GroupVersionKind]bool
+
+	// LivenessThreshold is how long a controller with queued keys or busy workers may go without a worker
+	// picking up or finishing a key before Livez reports it as blocked. Defaults to 5 minutes.
+	LivenessThreshold time.Duration
+
+	// Events enables the factory's event recorder. Unless disabled in the options, shared controllers record
+	// a Warning event on the involved object whenever one of their handlers fails.
+	Events *EventOptions
+}
+
+// controllerKey identifies the shared controllers of a factory, unscoped controllers have the zero Scope.
+type controllerKey struct {
+	gvr   schema.GroupVersionResource
+	scope cache.Scope
 }
 
 type sharedControllerFactory struct {
 	controllerLock sync.RWMutex
 
 	sharedCacheFactory cache.SharedCacheFactory
-	controllers        map[schema.GroupVersionResource]*sharedController
+	controllers        map[controllerKey]*sharedController
 
 	rateLimiter     workqueue.RateLimiter
 	workers         int
 	kindRateLimiter map[schema.GroupVersionKind]workqueue.RateLimiter
 	kindWorkers     map[schema.GroupVersionKind]int
+	kindStatus      map[schema.GroupVersionKind]bool
+	kindBatch       map[schema.GroupVersionKind]BatchOptions
 
+	name                   string
 	syncOnlyChangedObjects bool
+	namespaceFairness      bool
+	namespaceWeight        NamespaceWeightFunc
+	maxNamespaceMetrics    int
+	synchronous            bool
+	clock                  clock.WithTicker
+
+	eventRecorder *eventRecorder
+	handlerEvents bool
+
+	livenessThreshold time.Duration
 }
 
 func NewSharedControllerFactoryFromConfig(config *rest.Config, scheme *runtime.Scheme) (SharedControllerFactory, error) {
@@ -85,15 +164,32 @@ func NewSharedControllerFactoryFromConfigWithOptions(config *rest.Config, scheme
 
 func NewSharedControllerFactory(cacheFactory cache.SharedCacheFactory, opts *SharedControllerFactoryOptions) SharedControllerFactory {
 	opts = applyDefaultSharedOptions(opts)
-	return &sharedControllerFactory{
+	factory := &sharedControllerFactory{
 		sharedCacheFactory:     cacheFactory,
-		controllers:            map[schema.GroupVersionResource]*sharedController{},
+		controllers:            map[controllerKey]*sharedController{},
 		workers:                opts.DefaultWorkers,
 		kindWorkers:            opts.KindWorkers,
 		rateLimiter:            opts.DefaultRateLimiter,
 		kindRateLimiter:        opts.KindRateLimiter,
+		kindStatus:             opts.KindStatus,
+		kindBatch:              opts.KindBatch,
+		name:                   opts.Name,
+		livenessThreshold:      opts.LivenessThreshold,
 		syncOnlyChangedObjects: opts.SyncOnlyChangedObjects,
+		namespaceFairness:      opts.NamespaceFairness,
+		namespaceWeight:        opts.NamespaceWeight,
+		maxNamespaceMetrics:    opts.MaxNamespaceMetrics,
+		synchronous:            opts.Synchronous,
+		clock:                  opts.Clock,
+	}
+
+	if opts.Events != nil {
+		eventClient := cacheFactory.SharedClientFactory().ForResourceKind(eventsGVR, "Event", true)
+		factory.eventRecorder = newEventRecorder(eventClient, *opts.Events)
+		factory.handlerEvents = !opts.Events.DisableHandlerErrors
 	}
+
+	return factory
 }
 
 func applyDefaultSharedOptions(opts *SharedControllerFactoryOptions) *SharedControllerFactoryOptions {
@@ -104,6 +200,12 @@ func applyDefaultSharedOptions(opts *SharedControllerFactoryOptions) *SharedCont
 	if newOpts.DefaultWorkers == 0 {
 		newOpts.DefaultWorkers = 5
 	}
+	if newOpts.Clock == nil {
+		newOpts.Clock = clock.RealClock{}
+	}
+	if newOpts.LivenessThreshold == 0 {
+		newOpts.LivenessThreshold = defaultLivenessThreshold
+	}
 	return &newOpts
 }
 
@@ -119,8 +221,14 @@ func (s *sharedControllerFactory) Start(ctx context.Context, defaultWorkers int)
 		return err
 	}
 
+	if s.eventRecorder != nil {
+		if err := s.eventRecorder.start(ctx); err != nil {
+			return err
+		}
+	}
+
 	// copy so we can release the lock during cache wait
-	controllersCopy := map[schema.GroupVersionResource]*sharedController{}
+	controllersCopy := map[controllerKey]*sharedController{}
 	for k, v := range s.controllers {
 		controllersCopy[k] = v
 	}
@@ -129,20 +237,38 @@ func (s *sharedControllerFactory) Start(ctx context.Context, defaultWorkers int)
 	// one of the handlers you are waiting on tries to acquire this lock (by looking up
 	// shared controller)
 	s.controllerLock.Unlock()
-	s.sharedCacheFactory.WaitForCacheSync(ctx)
+	synced := s.sharedCacheFactory.WaitForCacheSync(ctx)
 	s.controllerLock.Lock()
 
-	for gvr, controller := range controllersCopy {
-		w, err := s.getWorkers(gvr, defaultWorkers)
+	// a controller that fails to start does not keep the others from starting, controllers whose construction
+	// failed are retried in the background
+	var errs []error
+	for key, controller := range controllersCopy {
+		w, err := s.getWorkers(key.gvr, defaultWorkers)
 		if err != nil {
-			return err
+			errs = append(errs, err)
+			continue
+		}
+		// controllers of kinds whose caches did not sync within their sync timeout start once they synced,
+		// without holding up the others
+		if gvk, err := s.sharedCacheFactory.SharedClientFactory().GVKForResource(key.gvr); err == nil && ctx.Err() == nil {
+			if ok, started := synced[gvk]; started && !ok {
+				name := s.controllerName(scopedName(key.gvr.String(), key.scope))
+				log.Infof("Starting controller %s once its cache synced", name)
+				go func() {
+					if err := controller.Start(ctx, w); err != nil && ctx.Err() == nil {
+						log.Errorf("failed to start controller %s: %v", name, err)
+					}
+				}()
+				continue
+			}
 		}
 		if err := controller.Start(ctx, w); err != nil {
-			return err
+			errs = append(errs, err)
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 func (s *sharedControllerFactory) ForObject(obj runtime.Object) (SharedController, error) {
@@ -167,7 +293,21 @@ func (s *sharedControllerFactory) ForResource(gvr schema.GroupVersionResource, n
 }
 
 func (s *sharedControllerFactory) ForResourceKind(gvr schema.GroupVersionResource, kind string, namespaced bool) SharedController {
-	controllerResult := s.byResource(gvr)
+	return s.forResourceKindScope(gvr, kind, namespaced, cache.Scope{})
+}
+
+func (s *sharedControllerFactory) ForKindScope(gvk schema.GroupVersionKind, scope cache.Scope) (SharedController, error) {
+	gvr, nsed, err := s.sharedCacheFactory.SharedClientFactory().ResourceForGVK(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.forResourceKindScope(gvr, gvk.Kind, nsed, scope), nil
+}
+
+func (s *sharedControllerFactory) forResourceKindScope(gvr schema.GroupVersionResource, kind string, namespaced bool, scope cache.Scope) SharedController {
+	key := controllerKey{gvr: gvr, scope: scope}
+	controllerResult := s.byResource(key)
 	if controllerResult != nil {
 		return controllerResult
 	}
@@ -175,14 +315,17 @@ func (s *sharedControllerFactory) ForResourceKind(gvr schema.GroupVersionResourc
 	s.controllerLock.Lock()
 	defer s.controllerLock.Unlock()
 
-	controllerResult = s.controllers[gvr]
+	controllerResult = s.controllers[key]
 	if controllerResult != nil {
 		return controllerResult
 	}
 
 	client := s.sharedCacheFactory.SharedClientFactory().ForResourceKind(gvr, kind, namespaced)
 
-	handler := &SharedHandler{controllerGVR: gvr.String()}
+	handler := &SharedHandler{controllerGVR: s.controllerName(scopedName(gvr.String(), scope))}
+	if s.handlerEvents {
+		handler.eventRecorder = s.eventRecorder
+	}
 
 	controllerResult = &sharedController{
 		deferredController: func() (Controller, error) {
@@ -200,32 +343,64 @@ func (s *sharedControllerFactory) ForResourceKind(gvr schema.GroupVersionResourc
 				gvk = gvr.GroupVersion().WithKind(kind)
 			}
 
-			cache, err := s.sharedCacheFactory.ForResourceKind(gvr, kind, namespaced)
+			informer, release, err := cache.AcquireResourceKind(s.sharedCacheFactory, gvr, kind, namespaced, scope)
 			if err != nil {
 				return nil, err
 			}
 
+			if s.kindStatus[gvk] {
+				obj, _, err := s.sharedCacheFactory.SharedClientFactory().NewObjects(gvk)
+				if err == nil {
+					err = checkStatusFields(obj)
+				}
+				if err != nil {
+					release()
+					return nil, fmt.Errorf("status updates of %s: %w", gvk, err)
+				}
+				handler.statusWriter = &statusWriter{client: client}
+			}
+
 			rateLimiter, ok := s.kindRateLimiter[gvk]
 			if !ok {
 				rateLimiter = s.rateLimiter
 			}
 
+			// the controller holds its reference on the cache until it is stopped
+			var releaseOnStop sync.Once
 			starter := func(ctx context.Context) error {
+				releaseOnStop.Do(func() {
+					context.AfterFunc(ctx, release)
+				})
+				if handler.statusWriter != nil {
+					handler.statusWriter.start(ctx)
+				}
 				return s.sharedCacheFactory.StartGVK(ctx, gvk)
 			}
 
-			c := New(gvk.String(), cache, starter, handler, &Options{
+			batch, batched := s.kindBatch[gvk]
+			c := newController(s.controllerName(scopedName(gvk.String(), scope)), informer, starter, handler, &Options{
 				RateLimiter:            rateLimiter,
 				SyncOnlyChangedObjects: s.syncOnlyChangedObjects,
+				NamespaceFairness:      s.namespaceFairness,
+				NamespaceWeight:        s.namespaceWeight,
+				MaxNamespaceMetrics:    s.maxNamespaceMetrics,
+				MaxBatchSize:           batch.MaxBatchSize,
+				BatchWait:              batch.Wait,
+				Synchronous:            s.synchronous,
+				Clock:                  s.clock,
 			})
+			if batched {
+				c.batchHandler = handler
+			}
 
 			return c, err
 		},
 		handler: handler,
 		client:  client,
+		clock:   s.clock,
 	}
 
-	s.controllers[gvr] = controllerResult
+	s.controllers[key] = controllerResult
 	return controllerResult
 }
 
@@ -247,12 +422,34 @@ func (s *sharedControllerFactory) getWorkers(gvr schema.GroupVersionResource, wo
 	return s.workers, nil
 }
 
-func (s *sharedControllerFactory) byResource(gvr schema.GroupVersionResource) *sharedController {
+func (s *sharedControllerFactory) controllerName(name string) string {
+	if s.name == "" {
+		return name
+	}
+	return s.name + "/" + name
+}
+
+// scopedName appends the scope to the name of scoped controllers.
+func scopedName(name string, scope cache.Scope) string {
+	if scope == (cache.Scope{}) {
+		return name
+	}
+	return name + "[" + scope.String() + "]"
+}
+
+func (s *sharedControllerFactory) byResource(key controllerKey) *sharedController {
 	s.controllerLock.RLock()
 	defer s.controllerLock.RUnlock()
-	return s.controllers[gvr]
+	return s.controllers[key]
 }
 
 func (s *sharedControllerFactory) SharedCacheFactory() cache.SharedCacheFactory {
 	return s.sharedCacheFactory
 }
+
+func (s *sharedControllerFactory) EventRecorder() events.EventRecorder {
+	if s.eventRecorder == nil {
+		return noopEventRecorder{}
+	}
+	return s.eventRecorder
+}
@@ -0,0 +1,161 @@
+package controller_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/rancher/lasso/pkg/controller"
+	"github.com/rancher/lasso/pkg/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var configMapGVK = corev1.SchemeGroupVersion.WithKind("ConfigMap")
+
+// newTestFactory returns a fake factory seeded with the objects and a context that is cancelled when the test ends.
+func newTestFactory(t *testing.T, opts *fake.Options, objs ...runtime.Object) (*fake.Factory, context.Context) {
+	t.Helper()
+	f, err := fake.NewSharedControllerFactory(opts, objs...)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return f, ctx
+}
+
+// forKind returns the shared controller of the kind.
+func forKind(t *testing.T, f *fake.Factory, gvk schema.GroupVersionKind) controller.SharedController {
+	t.Helper()
+	c, err := f.ForKind(gvk)
+	require.NoError(t, err)
+	return c
+}
+
+func eventually(t *testing.T, condition func() bool, msgAndArgs ...interface{}) {
+	t.Helper()
+	assert.Eventually(t, condition, 5*time.Second, 10*time.Millisecond, msgAndArgs...)
+}
+
+func TestFactoryScopedControllers(t *testing.T) {
+	f, ctx := newTestFactory(t, nil,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "blue", Namespace: "a", Labels: map[string]string{"color": "blue"}}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "red", Namespace: "a", Labels: map[string]string{"color": "red"}}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "blue", Namespace: "b", Labels: map[string]string{"color": "blue"}}},
+	)
+	blue := cache.Scope{LabelSelector: "color=blue"}
+
+	var (
+		lock    sync.Mutex
+		handled = map[string]bool{}
+	)
+	blueConfigMaps, err := controller.ForKindScope(f, configMapGVK, blue)
+	require.NoError(t, err)
+	blueConfigMaps.RegisterHandler(ctx, "record", controller.SharedControllerHandlerFunc(func(key string, obj runtime.Object) (runtime.Object, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		handled[key] = obj != nil
+		return obj, nil
+	}))
+	require.NoError(t, f.Start(ctx, 1))
+
+	eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return assert.ObjectsAreEqual(map[string]bool{"a/blue": true, "b/blue": true}, handled)
+	})
+
+	// the controller shares the scoped cache of the cache factory
+	blueCache, err := cache.ForKindScope(f.SharedCacheFactory(), configMapGVK, blue)
+	require.NoError(t, err)
+	assert.Same(t, blueCache, blueConfigMaps.Informer())
+}
+
+func TestFactoryStartsControllersOfUnsyncedKinds(t *testing.T) {
+	secretGVK := corev1.SchemeGroupVersion.WithKind("Secret")
+	f, ctx := newTestFactory(t, &fake.Options{
+		ControllerOptions: &controller.SharedControllerFactoryOptions{
+			CacheOptions: &cache.SharedCacheFactoryOptions{
+				KindSyncTimeout: map[schema.GroupVersionKind]time.Duration{secretGVK: 200 * time.Millisecond},
+			},
+		},
+	},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "default"}},
+	)
+	require.NoError(t, f.Forbid(secretGVK, true))
+
+	// the config map handler enqueues into the secrets controller, whose cache does not sync
+	secrets := forKind(t, f, secretGVK)
+	var secretKeys sync.Map
+	secrets.RegisterHandler(ctx, "record", controller.SharedControllerHandlerFunc(func(key string, obj runtime.Object) (runtime.Object, error) {
+		secretKeys.Store(key, true)
+		return obj, nil
+	}))
+	var handled atomic.Bool
+	forKind(t, f, configMapGVK).RegisterHandler(ctx, "enqueue", controller.SharedControllerHandlerFunc(func(key string, obj runtime.Object) (runtime.Object, error) {
+		secrets.EnqueueKey("default/enqueued")
+		secrets.Informer().GetStore().ListKeys()
+		handled.Store(true)
+		return obj, nil
+	}))
+
+	// the forbidden secrets must neither block starting the factory nor the handlers enqueueing into them
+	started := make(chan error, 1)
+	go func() {
+		started <- f.Start(ctx, 1)
+	}()
+	select {
+	case err := <-started:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("starting the factory blocked on the secrets cache")
+	}
+	eventually(t, handled.Load, "the config map handler blocked on the secrets controller")
+
+	// the enqueued keys are handled once the secrets controller started
+	require.NoError(t, f.Forbid(secretGVK, false))
+	assert.Eventually(t, func() bool {
+		_, enqueued := secretKeys.Load("default/enqueued")
+		_, listed := secretKeys.Load("default/secret")
+		return enqueued && listed
+	}, 15*time.Second, 10*time.Millisecond)
+}
+
+func TestFactoryMetadataOnlyCache(t *testing.T) {
+	f, ctx := newTestFactory(t, &fake.Options{
+		ControllerOptions: &controller.SharedControllerFactoryOptions{
+			CacheOptions: &cache.SharedCacheFactoryOptions{
+				KindMetadataOnly: map[schema.GroupVersionKind]bool{
+					configMapGVK: true,
+				},
+			},
+		},
+	}, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "seeded", Namespace: "default"},
+		Data:       map[string]string{"large": "data"},
+	})
+
+	// handlers of metadata only kinds receive PartialObjectMetadata
+	var handled atomic.Value
+	forKind(t, f, configMapGVK).RegisterHandler(ctx, "metadata", controller.SharedControllerHandlerFunc(func(key string, obj runtime.Object) (runtime.Object, error) {
+		if obj != nil {
+			handled.Store(obj)
+		}
+		return obj, nil
+	}))
+	require.NoError(t, f.Start(ctx, 1))
+
+	eventually(t, func() bool {
+		return handled.Load() != nil
+	})
+	obj, ok := handled.Load().(*metav1.PartialObjectMetadata)
+	require.True(t, ok, "handler received %T", handled.Load())
+	assert.Equal(t, "seeded", obj.Name)
+}
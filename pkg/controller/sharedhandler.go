@@ -23,27 +23,37 @@ type handlerEntry struct {
 	id      int64
 	name    string
 	handler SharedControllerHandler
+	batch   BatchHandler
 }
 
 type SharedHandler struct {
 	// keep first because arm32 needs atomic.AddInt64 target to be mem aligned
 	idCounter     int64
 	controllerGVR string
+	eventRecorder *eventRecorder
+	statusWriter  *statusWriter
 
 	lock     sync.RWMutex
 	handlers []handlerEntry
 }
 
 func (h *SharedHandler) Register(ctx context.Context, name string, handler SharedControllerHandler) {
+	h.register(ctx, handlerEntry{name: name, handler: handler})
+}
+
+// RegisterBatch registers a handler that is called with the batches of the controller after the other handlers
+// ran for the keys of the batch.
+func (h *SharedHandler) RegisterBatch(ctx context.Context, name string, handler BatchHandler) {
+	h.register(ctx, handlerEntry{name: name, batch: handler})
+}
+
+func (h *SharedHandler) register(ctx context.Context, entry handlerEntry) {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 
 	id := atomic.AddInt64(&h.idCounter, 1)
-	h.handlers = append(h.handlers, handlerEntry{
-		id:      id,
-		name:    name,
-		handler: handler,
-	})
+	entry.id = id
+	h.handlers = append(h.handlers, entry)
 
 	go func() {
 		<-ctx.Done()
@@ -61,17 +71,49 @@ func (h *SharedHandler) Register(ctx context.Context, name string, handler Share
 }
 
 func (h *SharedHandler) OnChange(key string, obj runtime.Object) error {
+	handlers := h.snapshot()
+	newObj, errs := h.onChange(handlers, key, obj)
+	errs = append(errs, h.onChangeBatch(handlers, []BatchItem{{Key: key, Object: obj}})[key]...)
+	return h.updateStatus(newObj, errs).ToErr()
+}
+
+// OnChangeBatch runs the handlers for every key of the batch and then calls the batch handlers with the batch.
+func (h *SharedHandler) OnChangeBatch(items []BatchItem) map[string]error {
+	handlers := h.snapshot()
+	errs := map[string]errorList{}
+	objects := map[string]runtime.Object{}
+	for _, item := range items {
+		objects[item.Key], errs[item.Key] = h.onChange(handlers, item.Key, item.Object)
+	}
+	for key, batchErrs := range h.onChangeBatch(handlers, items) {
+		errs[key] = append(errs[key], batchErrs...)
+	}
+
+	result := map[string]error{}
+	for _, item := range items {
+		if err := h.updateStatus(objects[item.Key], errs[item.Key]).ToErr(); err != nil {
+			result[item.Key] = err
+		}
+	}
+	return result
+}
+
+func (h *SharedHandler) snapshot() []handlerEntry {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return append([]handlerEntry(nil), h.handlers...)
+}
+
+// onChange runs the handlers for the key and returns the object returned by the last handler together with the
+// errors of the handlers.
+func (h *SharedHandler) onChange(handlers []handlerEntry, key string, obj runtime.Object) (runtime.Object, errorList) {
 	var (
 		errs errorList
 	)
-	handlers := make([]handlerEntry, len(h.handlers))
-	h.lock.RLock()
-	for i, x := range h.handlers {
-		handlers[i] = x
-	}
-	h.lock.RUnlock()
-
 	for _, handler := range handlers {
+		if handler.handler == nil {
+			continue
+		}
 		var hasError bool
 		reconcileStartTS := time.Now()
 
@@ -82,6 +124,10 @@ func (h *SharedHandler) OnChange(key string, obj runtime.Object) error {
 				Err:         err,
 			})
 			hasError = true
+			metrics.IncHandlerErrors(h.controllerGVR, handler.name, errorReason(err))
+			if h.eventRecorder != nil && obj != nil {
+				h.eventRecorder.recordHandlerError(handler.name, obj, err)
+			}
 		}
 		metrics.IncTotalHandlerExecutions(h.controllerGVR, handler.name, hasError)
 		reconcileTime := time.Since(reconcileStartTS)
@@ -99,7 +145,51 @@ func (h *SharedHandler) OnChange(key string, obj runtime.Object) error {
 		}
 	}
 
-	return errs.ToErr()
+	return obj, errs
+}
+
+// updateStatus writes the result of all handlers of the key, including the batch handlers, to the status of the
+// object.
+func (h *SharedHandler) updateStatus(obj runtime.Object, errs errorList) errorList {
+	if h.statusWriter != nil && obj != nil {
+		if err := h.statusWriter.update(obj, errs); err != nil {
+			errs = append(errs, fmt.Errorf("updating status: %w", err))
+		}
+	}
+	return errs
+}
+
+// onChangeBatch calls the batch handlers and returns the errors of the failed keys.
+func (h *SharedHandler) onChangeBatch(handlers []handlerEntry, items []BatchItem) map[string]errorList {
+	errs := map[string]errorList{}
+	objects := map[string]runtime.Object{}
+	for _, item := range items {
+		objects[item.Key] = item.Object
+	}
+	for _, handler := range handlers {
+		if handler.batch == nil {
+			continue
+		}
+		reconcileStartTS := time.Now()
+		var hasError bool
+		for key, err := range handler.batch.OnChangeBatch(items) {
+			if err == nil || errors.Is(err, ErrIgnore) {
+				continue
+			}
+			hasError = true
+			errs[key] = append(errs[key], &handlerError{
+				HandlerName: handler.name,
+				Err:         err,
+			})
+			metrics.IncHandlerErrors(h.controllerGVR, handler.name, errorReason(err))
+			if h.eventRecorder != nil && objects[key] != nil {
+				h.eventRecorder.recordHandlerError(handler.name, objects[key], err)
+			}
+		}
+		metrics.IncTotalHandlerExecutions(h.controllerGVR, handler.name, hasError)
+		metrics.ReportReconcileTime(h.controllerGVR, handler.name, hasError, time.Since(reconcileStartTS).Seconds())
+	}
+	return errs
 }
 
 type errorList []error
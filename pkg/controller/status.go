@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/rancher/lasso/pkg/client"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// ConditionReady is True once every handler succeeded for the current generation of the object.
+	ConditionReady = "Ready"
+	// ConditionReconciling is True while failed handlers are being retried.
+	ConditionReconciling = "Reconciling"
+	// ConditionFailed is True when a handler failed, its message holds the handler errors.
+	ConditionFailed = "Failed"
+
+	ReasonReconciled = "Reconciled"
+	ReasonRetrying   = "Retrying"
+)
+
+// statusWriter writes the outcome of the handler chain to status.conditions and status.observedGeneration
+// of the reconciled object. Typed objects need a status with a conditions list shaped like metav1.Condition
+// and an observedGeneration field, see checkStatusFields.
+type statusWriter struct {
+	client *client.Client
+	// ctx is the context the controller was started with, status updates are cancelled with it
+	ctx atomic.Value
+}
+
+func (s *statusWriter) start(ctx context.Context) {
+	s.ctx.Store(ctx)
+}
+
+func (s *statusWriter) context() context.Context {
+	if ctx, ok := s.ctx.Load().(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// checkStatusFields returns an error if the typed status of obj can not hold the conditions and observedGeneration
+// written by the statusWriter. The conversion would drop them and every reconcile would update the status again.
+func checkStatusFields(obj runtime.Object) error {
+	if _, ok := obj.(runtime.Unstructured); ok {
+		return nil
+	}
+
+	now := metav1.Now()
+	content := map[string]interface{}{}
+	setStatus(content, 1, nil, now)
+	typed, err := fromUnstructuredContent(obj, content)
+	if err != nil {
+		return err
+	}
+	converted, err := toUnstructuredContent(typed)
+	if err != nil {
+		return err
+	}
+	if setStatus(converted, 1, nil, now) {
+		return fmt.Errorf("status of %T has no conditions or observedGeneration field", obj)
+	}
+	return nil
+}
+
+// update sets the conditions for the handler errors and only calls UpdateStatus if the status changed.
+func (s *statusWriter) update(obj runtime.Object, errs errorList) error {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if m.GetUID() == "" {
+		// not an object from the cache, handlers may return arbitrary objects
+		return nil
+	}
+
+	content, err := toUnstructuredContent(obj)
+	if err != nil {
+		return err
+	}
+	if !setStatus(content, m.GetGeneration(), errs, metav1.Now()) {
+		return nil
+	}
+
+	updated, err := fromUnstructuredContent(obj, content)
+	if err != nil {
+		return err
+	}
+	return s.client.UpdateStatus(s.context(), m.GetNamespace(), updated, newEmptyObject(obj), metav1.UpdateOptions{})
+}
+
+// setStatus sets the Ready, Reconciling and Failed conditions and the observedGeneration in the status of content,
+// returning whether anything changed.
+func setStatus(content map[string]interface{}, generation int64, errs errorList, now metav1.Time) bool {
+	status, _ := content["status"].(map[string]interface{})
+	if status == nil {
+		status = map[string]interface{}{}
+	}
+
+	ready := metav1.Condition{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: ReasonReconciled}
+	reconciling := metav1.Condition{Type: ConditionReconciling, Status: metav1.ConditionFalse, Reason: ReasonReconciled}
+	failed := metav1.Condition{Type: ConditionFailed, Status: metav1.ConditionFalse, Reason: ReasonReconciled}
+	if len(errs) > 0 {
+		ready = metav1.Condition{Type: ConditionReady, Status: metav1.ConditionFalse, Reason: HandlerErrorReason, Message: errs.Error()}
+		reconciling = metav1.Condition{Type: ConditionReconciling, Status: metav1.ConditionTrue, Reason: ReasonRetrying}
+		failed = metav1.Condition{Type: ConditionFailed, Status: metav1.ConditionTrue, Reason: HandlerErrorReason, Message: errs.Error()}
+	}
+
+	conditions, _ := status["conditions"].([]interface{})
+	changed := false
+	for _, condition := range []metav1.Condition{ready, reconciling, failed} {
+		condition.ObservedGeneration = generation
+		var conditionChanged bool
+		conditions, conditionChanged = setCondition(conditions, condition, now)
+		changed = changed || conditionChanged
+	}
+
+	if observed, _, _ := unstructured.NestedInt64(status, "observedGeneration"); observed != generation {
+		status["observedGeneration"] = generation
+		changed = true
+	}
+
+	if changed {
+		status["conditions"] = conditions
+		content["status"] = status
+	}
+	return changed
+}
+
+// setCondition updates the condition of the same type in conditions, keeping fields that are not part of
+// metav1.Condition. The lastTransitionTime is only set when the status changes.
+func setCondition(conditions []interface{}, condition metav1.Condition, now metav1.Time) ([]interface{}, bool) {
+	for _, c := range conditions {
+		existing, ok := c.(map[string]interface{})
+		if !ok || existing["type"] != condition.Type {
+			continue
+		}
+
+		changed := false
+		set := func(field string, value interface{}) {
+			if !reflect.DeepEqual(existing[field], value) {
+				existing[field] = value
+				changed = true
+			}
+		}
+		if existing["status"] != string(condition.Status) {
+			set("lastTransitionTime", now.UTC().Format(metav1.RFC3339Micro))
+		}
+		set("status", string(condition.Status))
+		set("reason", condition.Reason)
+		set("message", condition.Message)
+		if observed, _, _ := unstructured.NestedInt64(existing, "observedGeneration"); observed != condition.ObservedGeneration {
+			set("observedGeneration", condition.ObservedGeneration)
+		}
+		return conditions, changed
+	}
+
+	return append(conditions, map[string]interface{}{
+		"type":               condition.Type,
+		"status":             string(condition.Status),
+		"reason":             condition.Reason,
+		"message":            condition.Message,
+		"observedGeneration": condition.ObservedGeneration,
+		"lastTransitionTime": now.UTC().Format(metav1.RFC3339Micro),
+	}), true
+}
+
+func toUnstructuredContent(obj runtime.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(runtime.Unstructured); ok {
+		// objects from the cache must not be modified
+		return runtime.DeepCopyJSON(u.UnstructuredContent()), nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
+
+func fromUnstructuredContent(obj runtime.Object, content map[string]interface{}) (runtime.Object, error) {
+	if _, ok := obj.(runtime.Unstructured); ok {
+		return &unstructured.Unstructured{Object: content}, nil
+	}
+	result := newEmptyObject(obj)
+	if result == nil {
+		return nil, errors.New("can not create object to update status")
+	}
+	return result, runtime.DefaultUnstructuredConverter.FromUnstructured(content, result)
+}
+
+func newEmptyObject(obj runtime.Object) runtime.Object {
+	if _, ok := obj.(runtime.Unstructured); ok {
+		return &unstructured.Unstructured{}
+	}
+	t := reflect.TypeOf(obj)
+	if t.Kind() != reflect.Ptr {
+		return nil
+	}
+	result, _ := reflect.New(t.Elem()).Interface().(runtime.Object)
+	return result
+}
@@ -0,0 +1,70 @@
+package controller_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rancher/lasso/pkg/controller"
+	"github.com/rancher/lasso/pkg/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFactoryUpdatesStatus(t *testing.T) {
+	pdbGVK := policyv1.SchemeGroupVersion.WithKind("PodDisruptionBudget")
+	f, ctx := newTestFactory(t, &fake.Options{
+		ControllerOptions: &controller.SharedControllerFactoryOptions{
+			KindStatus: map[schema.GroupVersionKind]bool{pdbGVK: true},
+		},
+	}, &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "pdb", Namespace: "default"},
+	})
+
+	pdbs := forKind(t, f, pdbGVK)
+	var (
+		calls     int32
+		seenReady atomic.Bool
+	)
+	pdbs.RegisterHandler(ctx, "flaky", controller.SharedControllerHandlerFunc(func(key string, obj runtime.Object) (runtime.Object, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return obj, errors.New("first try")
+		}
+		if pdb, ok := obj.(*policyv1.PodDisruptionBudget); ok && meta.IsStatusConditionTrue(pdb.Status.Conditions, controller.ConditionReady) {
+			seenReady.Store(true)
+		}
+		return obj, nil
+	}))
+
+	require.NoError(t, f.Start(ctx, 1))
+
+	var pdb *policyv1.PodDisruptionBudget
+	eventually(t, func() bool {
+		obj, err := f.Get(pdbGVK, "default", "pdb")
+		if err != nil {
+			return false
+		}
+		pdb = obj.(*policyv1.PodDisruptionBudget)
+		return meta.IsStatusConditionTrue(pdb.Status.Conditions, controller.ConditionReady)
+	})
+
+	assert.Equal(t, pdb.Generation, pdb.Status.ObservedGeneration)
+	assert.True(t, meta.IsStatusConditionFalse(pdb.Status.Conditions, controller.ConditionFailed))
+
+	// the status update triggers another reconcile that must not write the unchanged status again. With a single
+	// worker, the reconcile of another enqueue starts only after that reconcile finished.
+	eventually(t, seenReady.Load)
+	handled := atomic.LoadInt32(&calls)
+	pdbs.Enqueue("default", "pdb")
+	eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) > handled
+	})
+	obj, err := f.Get(pdbGVK, "default", "pdb")
+	require.NoError(t, err)
+	assert.Equal(t, pdb.ResourceVersion, obj.(*policyv1.PodDisruptionBudget).ResourceVersion)
+}
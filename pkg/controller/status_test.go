@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSetStatus(t *testing.T) {
+	now := metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	later := metav1.NewTime(now.Add(time.Minute))
+	content := map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Custom", "status": "True"},
+			},
+		},
+	}
+
+	failed := errorList{&handlerError{HandlerName: "test", Err: errors.New("boom")}}
+	assert.True(t, setStatus(content, 2, failed, now))
+	assert.False(t, setStatus(content, 2, failed, later), "unchanged status must not be updated")
+
+	ready := condition(t, content, ConditionReady)
+	assert.Equal(t, "False", ready["status"])
+	assert.Equal(t, "handler test: boom", ready["message"])
+	assert.Equal(t, "True", condition(t, content, ConditionFailed)["status"])
+	assert.Equal(t, "True", condition(t, content, "Custom")["status"])
+
+	observed, _, _ := unstructured.NestedInt64(content, "status", "observedGeneration")
+	assert.Equal(t, int64(2), observed)
+
+	assert.True(t, setStatus(content, 3, nil, later))
+	ready = condition(t, content, ConditionReady)
+	assert.Equal(t, "True", ready["status"])
+	assert.Equal(t, later.UTC().Format(metav1.RFC3339Micro), ready["lastTransitionTime"])
+	assert.Equal(t, int64(3), ready["observedGeneration"])
+	assert.Equal(t, "False", condition(t, content, ConditionReconciling)["status"])
+}
+
+func TestCheckStatusFields(t *testing.T) {
+	assert.NoError(t, checkStatusFields(&policyv1.PodDisruptionBudget{}))
+	assert.NoError(t, checkStatusFields(&unstructured.Unstructured{}))
+	// no conditions
+	assert.Error(t, checkStatusFields(&corev1.Namespace{}))
+	// no status
+	assert.Error(t, checkStatusFields(&corev1.ConfigMap{}))
+}
+
+func condition(t *testing.T, content map[string]interface{}, conditionType string) map[string]interface{} {
+	conditions, _, _ := unstructured.NestedSlice(content, "status", "conditions")
+	for _, c := range conditions {
+		if c := c.(map[string]interface{}); c["type"] == conditionType {
+			return c
+		}
+	}
+	t.Fatalf("condition %s not found", conditionType)
+	return nil
+}
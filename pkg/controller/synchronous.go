@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
+)
+
+// SynchronousController is implemented by controllers created with Options.Synchronous. Their workers are
+// not started by Start, instead ProcessUntilIdle runs the handler on the caller's goroutine.
+type SynchronousController interface {
+	Controller
+
+	// ProcessUntilIdle handles every queued key until the queue is empty and no delayed key is left. Keys
+	// added with EnqueueAfter or requeued by the rate limiter are made ready by moving the controller's clock
+	// forward, if it is settable like a fake clock, or by waiting for them otherwise. Since a handler that keeps
+	// failing is requeued forever, ProcessUntilIdle also returns when ctx is done.
+	ProcessUntilIdle(ctx context.Context) error
+}
+
+type settableClock interface {
+	SetTime(t time.Time)
+}
+
+// synchronousDelayingQueue replaces the delaying queue of synchronous controllers. Instead of a goroutine
+// that adds delayed items once they are due, items are only moved to the queue by promote, so that delays
+// are driven entirely by ProcessUntilIdle.
+type synchronousDelayingQueue struct {
+	workqueue.Interface
+
+	clock   clock.Clock
+	lock    sync.Mutex
+	waiting map[interface{}]time.Time
+}
+
+func newSynchronousDelayingQueue(queue workqueue.Interface, clock clock.Clock) *synchronousDelayingQueue {
+	return &synchronousDelayingQueue{
+		Interface: queue,
+		clock:     clock,
+		waiting:   map[interface{}]time.Time{},
+	}
+}
+
+func (q *synchronousDelayingQueue) AddAfter(item interface{}, duration time.Duration) {
+	if q.ShuttingDown() {
+		return
+	}
+	if duration <= 0 {
+		q.Add(item)
+		return
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	readyAt := q.clock.Now().Add(duration)
+	// like the client-go delaying queue, only the earliest time is kept for an item added several times
+	if existing, ok := q.waiting[item]; !ok || readyAt.Before(existing) {
+		q.waiting[item] = readyAt
+	}
+}
+
+// promote adds the items that are due to the queue and returns when the next waiting item is due.
+func (q *synchronousDelayingQueue) promote() (time.Time, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var (
+		now     = q.clock.Now()
+		next    time.Time
+		waiting bool
+	)
+	for item, readyAt := range q.waiting {
+		if !readyAt.After(now) {
+			delete(q.waiting, item)
+			q.Add(item)
+			continue
+		}
+		if !waiting || readyAt.Before(next) {
+			next = readyAt
+			waiting = true
+		}
+	}
+	return next, waiting
+}
+
+func (c *controller) ProcessUntilIdle(ctx context.Context) error {
+	c.startLock.Lock()
+	queue, syncQueue := c.workqueue, c.syncQueue
+	c.startLock.Unlock()
+
+	if syncQueue == nil {
+		return fmt.Errorf("controller %s is not synchronous or not started", c.name)
+	}
+
+	// the initial list is delivered to the event handler asynchronously, wait for it so that every
+	// existing key has been enqueued
+	if c.registration != nil && !cache.WaitForCacheSync(ctx.Done(), c.registration.HasSynced) {
+		return fmt.Errorf("failed to wait for event handler of controller %s to sync", c.name)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		next, waiting := syncQueue.promote()
+		if queue.Len() > 0 {
+			c.processReady(queue)
+			continue
+		}
+		if !waiting {
+			return nil
+		}
+
+		if settable, ok := c.clock.(settableClock); ok {
+			settable.SetTime(next)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.clock.After(next.Sub(c.clock.Now())):
+		}
+	}
+}
+
+// processReady handles the next ready key, or the next batch of ready keys for batch controllers.
+func (c *controller) processReady(queue workqueue.Interface) {
+	if c.batchHandler == nil {
+		c.processNextWorkItem()
+		return
+	}
+
+	var batch []interface{}
+	for len(batch) < c.batchSize && queue.Len() > 0 {
+		obj, shutdown := queue.Get()
+		if shutdown {
+			break
+		}
+		batch = append(batch, obj)
+	}
+	c.processBatch(batch)
+}
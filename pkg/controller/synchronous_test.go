@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func newTestInformer(objs ...corev1.ConfigMap) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return &corev1.ConfigMapList{Items: objs}, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}, &corev1.ConfigMap{}, 0, cache.Indexers{})
+}
+
+func TestProcessUntilIdle(t *testing.T) {
+	informer := newTestInformer(corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "ns"}})
+	start := time.Now()
+	fakeClock := clocktesting.NewFakeClock(start)
+
+	calls := map[string]int{}
+	c := New("test", informer, func(ctx context.Context) error {
+		go informer.Run(ctx.Done())
+		return nil
+	}, HandlerFunc(func(key string, obj runtime.Object) error {
+		calls[key]++
+		if key == "ns/a" && calls[key] < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}), &Options{
+		Synchronous: true,
+		Clock:       fakeClock,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.NoError(t, c.Start(ctx, 1))
+	c.EnqueueAfter("ns", "b", time.Hour)
+
+	sc, ok := c.(SynchronousController)
+	require.True(t, ok)
+	require.NoError(t, sc.ProcessUntilIdle(ctx))
+
+	assert.Equal(t, map[string]int{"ns/a": 3, "ns/b": 1}, calls)
+	assert.False(t, fakeClock.Now().Before(start.Add(time.Hour)))
+}
+
+func TestProcessUntilIdleNotSynchronous(t *testing.T) {
+	c := New("test", newTestInformer(), func(ctx context.Context) error { return nil }, HandlerFunc(func(string, runtime.Object) error {
+		return nil
+	}), nil)
+
+	assert.Error(t, c.(SynchronousController).ProcessUntilIdle(context.Background()))
+}
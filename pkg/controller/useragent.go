@@ -1,9 +1,14 @@
 package controller
 
 import (
+	"context"
+	"net/http"
+
+	"github.com/rancher/lasso/pkg/cache"
 	"github.com/rancher/lasso/pkg/client"
 	"github.com/rancher/lasso/pkg/log"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/events"
 )
 
 type sharedControllerFactoryWithAgent struct {
@@ -19,8 +24,8 @@ type sharedControllerWithAgent struct {
 }
 
 // NewSharedControllerFactoryWithAgent returns a controller factory that is equivalent to the passed controller factory
-// with the addition that it will wrap the returned controllers from ForKind, ForResource, and ForResourceKind with the
-// sharedController struct using the passed user agent.
+// with the addition that it will wrap the returned controllers from ForKind, ForResource, ForResourceKind, and
+// ForKindScope with the sharedController struct using the passed user agent.
 func NewSharedControllerFactoryWithAgent(userAgent string, clientFactory SharedControllerFactory) SharedControllerFactory {
 	return &sharedControllerFactoryWithAgent{
 		SharedControllerFactory: clientFactory,
@@ -54,6 +59,34 @@ func (s *sharedControllerFactoryWithAgent) ForResourceKind(gvr schema.GroupVersi
 	return NewSharedControllerWithAgent(s.userAgent, resourceController)
 }
 
+func (s *sharedControllerFactoryWithAgent) ForKindScope(gvk schema.GroupVersionKind, scope cache.Scope) (SharedController, error) {
+	resourceController, err := ForKindScope(s.SharedControllerFactory, gvk, scope)
+	if err != nil {
+		return resourceController, err
+	}
+
+	return NewSharedControllerWithAgent(s.userAgent, resourceController), err
+}
+
+func (s *sharedControllerFactoryWithAgent) EventRecorder() events.EventRecorder {
+	return EventRecorderFor(s.SharedControllerFactory)
+}
+
+func (s *sharedControllerFactoryWithAgent) Readyz() http.Handler {
+	return ReadyzFor(s.SharedControllerFactory)
+}
+
+func (s *sharedControllerFactoryWithAgent) Livez() http.Handler {
+	return LivezFor(s.SharedControllerFactory)
+}
+
+func (s *sharedControllerWithAgent) ConstructionStatus() ConstructionStatus {
+	if reporter, ok := s.SharedController.(ConstructionReporter); ok {
+		return reporter.ConstructionStatus()
+	}
+	return ConstructionStatus{Constructed: true}
+}
+
 func (s *sharedControllerWithAgent) Client() *client.Client {
 	client := s.SharedController.Client()
 	if client == nil {
@@ -66,3 +99,12 @@ func (s *sharedControllerWithAgent) Client() *client.Client {
 	}
 	return clientWithAgent
 }
+
+func (s *sharedControllerWithAgent) RegisterBatchHandler(ctx context.Context, name string, handler BatchHandler) {
+	batchController, ok := s.SharedController.(SharedBatchController)
+	if !ok {
+		log.Errorf("shared controller does not support batch handlers, not registering %s", name)
+		return
+	}
+	batchController.RegisterBatchHandler(ctx, name, handler)
+}
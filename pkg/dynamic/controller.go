@@ -111,23 +111,23 @@ func (c *Controller) OnChange(ctx context.Context, name string, matcher GVKMatch
 	})
 }
 
-func (c *Controller) getCache(ctx context.Context, gvk schema.GroupVersionKind) (cache.SharedIndexInformer, bool, error) {
+func (c *Controller) getCache(ctx context.Context, gvk schema.GroupVersionKind) (cache.SharedIndexInformer, lcache.ReleaseFunc, bool, error) {
 	if c.cacheFactory.WaitForCacheSync(ctx)[gvk] {
-		cache, err := c.cacheFactory.ForKind(gvk)
-		return cache, true, err
+		cache, release, err := lcache.Acquire(c.cacheFactory, gvk, lcache.Scope{})
+		return cache, release, true, err
 	}
 
 	client, err := c.clientFactory.ForKind(gvk)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
 	}
 
 	obj, objList, err := c.clientFactory.NewObjects(gvk)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
 	}
 
-	return lcache.NewCache(obj, objList, client, nil), false, nil
+	return lcache.NewCache(obj, objList, client, nil), func() {}, false, nil
 }
 
 func (c *Controller) OnGVKs(gvkList []schema.GroupVersionKind) error {
@@ -157,7 +157,7 @@ outer:
 			continue
 		}
 
-		informer, shared, err := c.getCache(timeoutCtx, gvk)
+		informer, release, shared, err := c.getCache(timeoutCtx, gvk)
 		if err != nil {
 			errs = append(errs, err)
 			log.Errorf("Failed to get shared cache for %v: %v", gvk, err)
@@ -176,6 +176,7 @@ outer:
 					errs = append(errs, err)
 					log.Errorf("failed to add indexer %s to gvk %s: %v", indexer.name, gvk, err)
 					delete(gvks, gvk)
+					release()
 					continue outer
 				}
 			}
@@ -187,8 +188,11 @@ outer:
 
 		ctx, cancel := context.WithCancel(c.ctx)
 		w := &watcher{
-			ctx:        ctx,
-			cancel:     cancel,
+			ctx: ctx,
+			cancel: func() {
+				cancel()
+				release()
+			},
 			gvk:        gvk,
 			informer:   informer,
 			controller: controller,
@@ -0,0 +1,292 @@
+/*
+Package fake provides a SharedControllerFactory backed by an in-memory apiserver for unit testing handlers.
+The returned factory is the real lasso implementation, only the HTTP transport is replaced, so list/watch,
+caches, resourceVersion conflicts and registered handlers behave as they would against a cluster.
+*/
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/rancher/lasso/pkg/cache"
+	"github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/controller"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/events"
+)
+
+// defaultClusterScoped are the built-in kinds that are not namespaced.
+var defaultClusterScoped = []schema.GroupKind{
+	{Kind: "Namespace"},
+	{Kind: "Node"},
+	{Kind: "PersistentVolume"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"},
+	{Group: "storage.k8s.io", Kind: "StorageClass"},
+	{Group: "storage.k8s.io", Kind: "CSIDriver"},
+	{Group: "storage.k8s.io", Kind: "CSINode"},
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"},
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"},
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"},
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"},
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"},
+	{Group: "apiregistration.k8s.io", Kind: "APIService"},
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"},
+	{Group: "networking.k8s.io", Kind: "IngressClass"},
+	{Group: "node.k8s.io", Kind: "RuntimeClass"},
+}
+
+type Options struct {
+	// Scheme is used to decode typed objects, defaults to the client-go kubernetes scheme.
+	Scheme *runtime.Scheme
+	// Kinds lists additional kinds that are not registered in the scheme, they are served as unstructured objects.
+	Kinds []schema.GroupVersionKind
+	// ClusterScoped lists the kinds, in addition to the built-in cluster scoped kinds, that are not namespaced.
+	ClusterScoped []schema.GroupKind
+	// ControllerOptions are passed to the created SharedControllerFactory.
+	ControllerOptions *controller.SharedControllerFactoryOptions
+	// DisableWatchList makes the apiserver reject streaming lists, like apiservers before Kubernetes 1.27.
+	DisableWatchList bool
+}
+
+// Factory is a SharedControllerFactory whose apiserver is kept in memory. Objects can be seeded with Add and
+// what handlers wrote can be read back with Get and List.
+type Factory struct {
+	controller.SharedControllerFactory
+
+	config        *rest.Config
+	server        *server
+	clientFactory client.SharedClientFactory
+	scheme        *runtime.Scheme
+}
+
+// NewSharedControllerFactory returns a Factory seeded with the given objects.
+func NewSharedControllerFactory(opts *Options, objs ...runtime.Object) (*Factory, error) {
+	opts = applyDefaults(opts)
+
+	mapper := newMapper(opts)
+	s := &server{
+		store:  newStore(),
+		mapper: mapper,
+		scheme: opts.Scheme,
+
+		disableWatchList: opts.DisableWatchList,
+	}
+	config := &rest.Config{
+		Host:      "https://lasso.fake",
+		Transport: s,
+	}
+
+	cf, err := client.NewSharedClientFactory(config, &client.SharedClientFactoryOptions{
+		Mapper: mapper,
+		Scheme: opts.Scheme,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var cacheOpts *cache.SharedCacheFactoryOptions
+	if opts.ControllerOptions != nil {
+		cacheOpts = opts.ControllerOptions.CacheOptions
+	}
+
+	f := &Factory{
+		SharedControllerFactory: controller.NewSharedControllerFactory(cache.NewSharedCachedFactory(cf, cacheOpts), opts.ControllerOptions),
+		config:                  config,
+		server:                  s,
+		clientFactory:           cf,
+		scheme:                  opts.Scheme,
+	}
+	return f, f.Add(objs...)
+}
+
+func applyDefaults(opts *Options) *Options {
+	var newOpts Options
+	if opts != nil {
+		newOpts = *opts
+	}
+	if newOpts.Scheme == nil {
+		newOpts.Scheme = clientgoscheme.Scheme
+	}
+	return &newOpts
+}
+
+func newMapper(opts *Options) meta.RESTMapper {
+	clusterScoped := map[schema.GroupKind]bool{}
+	for _, gk := range append(defaultClusterScoped, opts.ClusterScoped...) {
+		clusterScoped[gk] = true
+	}
+
+	mapper := meta.NewDefaultRESTMapper(opts.Scheme.PrioritizedVersionsAllGroups())
+	add := func(gvk schema.GroupVersionKind) {
+		scope := meta.RESTScopeNamespace
+		if clusterScoped[gvk.GroupKind()] {
+			scope = meta.RESTScopeRoot
+		}
+		mapper.Add(gvk, scope)
+	}
+	for gvk := range opts.Scheme.AllKnownTypes() {
+		if gvk.Version == runtime.APIVersionInternal {
+			continue
+		}
+		add(gvk)
+	}
+	for _, gvk := range opts.Kinds {
+		add(gvk)
+	}
+	return mapper
+}
+
+// EventRecorder returns the event recorder of the wrapped factory, see controller.EventRecorderFor.
+func (f *Factory) EventRecorder() events.EventRecorder {
+	return controller.EventRecorderFor(f.SharedControllerFactory)
+}
+
+// ForKindScope returns the scoped controller of the wrapped factory, see controller.ForKindScope.
+func (f *Factory) ForKindScope(gvk schema.GroupVersionKind, scope cache.Scope) (controller.SharedController, error) {
+	return controller.ForKindScope(f.SharedControllerFactory, gvk, scope)
+}
+
+// RESTConfig returns a config that talks to the in-memory apiserver, for clients built outside of lasso.
+func (f *Factory) RESTConfig() *rest.Config {
+	return rest.CopyConfig(f.config)
+}
+
+// Readyz returns the readyz handler of the wrapped factory, see controller.ReadyzFor.
+func (f *Factory) Readyz() http.Handler {
+	return controller.ReadyzFor(f.SharedControllerFactory)
+}
+
+// Livez returns the livez handler of the wrapped factory, see controller.LivezFor.
+func (f *Factory) Livez() http.Handler {
+	return controller.LivezFor(f.SharedControllerFactory)
+}
+
+// RESTMapper returns the mapper of the in-memory apiserver, which does not serve discovery.
+func (f *Factory) RESTMapper() meta.RESTMapper {
+	return f.server.mapper
+}
+
+// Scheme returns the scheme the in-memory apiserver decodes typed objects with.
+func (f *Factory) Scheme() *runtime.Scheme {
+	return f.scheme
+}
+
+// Add creates the objects in the in-memory apiserver. Running caches observe them like any other change.
+func (f *Factory) Add(objs ...runtime.Object) error {
+	for _, obj := range objs {
+		gvk, c, err := f.clientFor(obj)
+		if err != nil {
+			return err
+		}
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return err
+		}
+		content["apiVersion"], content["kind"] = gvk.ToAPIVersionAndKind()
+
+		namespace := m.GetNamespace()
+		if !c.Namespaced {
+			namespace = ""
+		}
+		if _, err := f.server.store.create(c.GVR, namespace, content); err != nil {
+			return fmt.Errorf("adding %s %s/%s: %w", gvk.Kind, m.GetNamespace(), m.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// Get returns the current state of an object in the in-memory apiserver. Kinds registered in the scheme are
+// returned typed, other kinds as *unstructured.Unstructured.
+func (f *Factory) Get(gvk schema.GroupVersionKind, namespace, name string) (runtime.Object, error) {
+	c, err := f.clientFactory.ForKind(gvk)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := f.newObject(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return obj, c.Get(context.Background(), namespace, name, obj, metav1.GetOptions{})
+}
+
+// List returns the objects of the given kind in the namespace, or in all namespaces if namespace is empty.
+func (f *Factory) List(gvk schema.GroupVersionKind, namespace string) ([]runtime.Object, error) {
+	gvr, _, err := f.clientFactory.ResourceForGVK(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []runtime.Object
+	objs, _ := f.server.store.list(gvr, namespace, nil, nil)
+	for _, content := range objs {
+		obj, err := f.newObject(gvk)
+		if err != nil {
+			return nil, err
+		}
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			u.Object = content
+		} else if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, obj); err != nil {
+			return nil, err
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
+
+// Watches returns the number of open watches of the kind, for example to assert that caches were stopped.
+func (f *Factory) Watches(gvk schema.GroupVersionKind) (int, error) {
+	gvr, _, err := f.clientFactory.ResourceForGVK(gvk)
+	if err != nil {
+		return 0, err
+	}
+	return f.server.store.watches(gvr), nil
+}
+
+// Lists returns the number of list requests and of streaming lists that were served, for example to assert which
+// of both a cache used.
+func (f *Factory) Lists() (lists, watchLists int64) {
+	return f.server.lists.Load(), f.server.watchLists.Load()
+}
+
+// Forbid makes the apiserver reject lists of the kind like apiservers without RBAC access, so that its caches do
+// not sync, or lists them again.
+func (f *Factory) Forbid(gvk schema.GroupVersionKind, forbidden bool) error {
+	gvr, _, err := f.clientFactory.ResourceForGVK(gvk)
+	if err != nil {
+		return err
+	}
+	f.server.forbid(gvr.GroupResource(), forbidden)
+	return nil
+}
+
+func (f *Factory) newObject(gvk schema.GroupVersionKind) (runtime.Object, error) {
+	obj, _, err := f.clientFactory.NewObjects(gvk)
+	return obj, err
+}
+
+func (f *Factory) clientFor(obj runtime.Object) (schema.GroupVersionKind, *client.Client, error) {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if gvk.Empty() {
+		var err error
+		gvk, err = f.clientFactory.GVKForObject(obj)
+		if err != nil {
+			return gvk, nil, err
+		}
+	}
+	c, err := f.clientFactory.ForKind(gvk)
+	return gvk, c, err
+}
@@ -0,0 +1,112 @@
+package fake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rancher/lasso/pkg/controller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var configMapGVK = corev1.SchemeGroupVersion.WithKind("ConfigMap")
+
+// newTestFactory returns a factory seeded with the objects and a context that is cancelled when the test ends.
+func newTestFactory(t *testing.T, opts *Options, objs ...runtime.Object) (*Factory, context.Context) {
+	t.Helper()
+	f, err := NewSharedControllerFactory(opts, objs...)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return f, ctx
+}
+
+// forKind returns the shared controller of the kind.
+func forKind(t *testing.T, f *Factory, gvk schema.GroupVersionKind) controller.SharedController {
+	t.Helper()
+	c, err := f.ForKind(gvk)
+	require.NoError(t, err)
+	return c
+}
+
+func eventually(t *testing.T, condition func() bool, msgAndArgs ...interface{}) {
+	t.Helper()
+	assert.Eventually(t, condition, 5*time.Second, 10*time.Millisecond, msgAndArgs...)
+}
+
+func TestFactoryRunsHandlers(t *testing.T) {
+	f, ctx := newTestFactory(t, nil, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "seeded", Namespace: "default"},
+	})
+
+	configMaps := forKind(t, f, configMapGVK)
+	configMaps.RegisterHandler(ctx, "annotate", controller.SharedControllerHandlerFunc(func(key string, obj runtime.Object) (runtime.Object, error) {
+		if obj == nil {
+			return nil, nil
+		}
+		cm := obj.(*corev1.ConfigMap)
+		if cm.Annotations["handled"] == "true" {
+			return cm, nil
+		}
+		cm = cm.DeepCopy()
+		if cm.Annotations == nil {
+			cm.Annotations = map[string]string{}
+		}
+		cm.Annotations["handled"] = "true"
+		result := &corev1.ConfigMap{}
+		return result, configMaps.Client().Update(ctx, cm.Namespace, cm, result, metav1.UpdateOptions{})
+	}))
+
+	require.NoError(t, f.Start(ctx, 1))
+	require.NoError(t, f.Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "added", Namespace: "other"}}))
+
+	for _, key := range []types.NamespacedName{{Namespace: "default", Name: "seeded"}, {Namespace: "other", Name: "added"}} {
+		eventually(t, func() bool {
+			obj, err := f.Get(configMapGVK, key.Namespace, key.Name)
+			return err == nil && obj.(*corev1.ConfigMap).Annotations["handled"] == "true"
+		}, key.String())
+	}
+
+	objs, err := f.List(configMapGVK, "")
+	require.NoError(t, err)
+	assert.Len(t, objs, 2)
+}
+
+func TestFactoryResourceVersionSemantics(t *testing.T) {
+	f, ctx := newTestFactory(t, nil, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default", Finalizers: []string{"test"}},
+		Data:       map[string]string{"a": "1"},
+	})
+
+	c, err := f.SharedCacheFactory().SharedClientFactory().ForKind(configMapGVK)
+	require.NoError(t, err)
+
+	stale := &corev1.ConfigMap{}
+	require.NoError(t, c.Get(ctx, "default", "cm", stale, metav1.GetOptions{}))
+	assert.NotEmpty(t, stale.ResourceVersion)
+
+	patched := &corev1.ConfigMap{}
+	require.NoError(t, c.Patch(ctx, "default", "cm", types.MergePatchType, []byte(`{"data":{"b":"2"}}`), patched, metav1.PatchOptions{}))
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, patched.Data)
+	assert.NotEqual(t, stale.ResourceVersion, patched.ResourceVersion)
+
+	err = c.Update(ctx, "default", stale, &corev1.ConfigMap{}, metav1.UpdateOptions{})
+	assert.True(t, apierrors.IsConflict(err), "expected conflict, got %v", err)
+
+	// deleting an object with finalizers only marks it for deletion
+	require.NoError(t, c.Delete(ctx, "default", "cm", metav1.DeleteOptions{}))
+	obj, err := f.Get(configMapGVK, "default", "cm")
+	require.NoError(t, err)
+	assert.NotNil(t, obj.(*corev1.ConfigMap).DeletionTimestamp)
+
+	require.NoError(t, c.Patch(ctx, "default", "cm", types.JSONPatchType, []byte(`[{"op":"remove","path":"/metadata/finalizers"}]`), &corev1.ConfigMap{}, metav1.PatchOptions{}))
+	_, err = f.Get(configMapGVK, "default", "cm")
+	assert.True(t, apierrors.IsNotFound(err), "expected not found, got %v", err)
+}
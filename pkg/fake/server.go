@@ -0,0 +1,441 @@
+package fake
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+// server is an http.RoundTripper that answers kube-apiserver requests from the in-memory store, so that lasso's
+// clients, caches and controllers run unmodified on top of it.
+type server struct {
+	store  *store
+	mapper meta.RESTMapper
+	scheme *runtime.Scheme
+	// disableWatchList rejects streaming lists like apiservers without the WatchList feature
+	disableWatchList bool
+	// forbidden rejects lists of the resources like apiservers without RBAC access, see Factory.Forbid
+	forbiddenLock sync.RWMutex
+	forbidden     map[schema.GroupResource]bool
+
+	// lists and watchLists count the list requests and the streaming lists that were served
+	lists      atomic.Int64
+	watchLists atomic.Int64
+}
+
+type request struct {
+	gvr         schema.GroupVersionResource
+	gvk         schema.GroupVersionKind
+	namespace   string
+	name        string
+	subresource string
+}
+
+func (s *server) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == "/version" {
+		return jsonResponse(http.StatusOK, &version.Info{Major: "1", Minor: "32", GitVersion: "v1.32.0-lasso-fake"})
+	}
+
+	r, err := s.parse(req.URL.Path)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	query := req.URL.Query()
+	switch req.Method {
+	case http.MethodGet:
+		if r.name != "" {
+			return s.get(req, r)
+		}
+		if query.Get("watch") == "true" || query.Get("watch") == "1" {
+			return s.watch(req, r)
+		}
+		return s.list(req, r)
+	case http.MethodPost:
+		return s.create(req, r)
+	case http.MethodPut:
+		return s.update(req, r)
+	case http.MethodPatch:
+		return s.patch(req, r)
+	case http.MethodDelete:
+		if r.name == "" {
+			return s.deleteCollection(req, r)
+		}
+		return s.delete(r)
+	}
+	return errorResponse(apierrors.NewMethodNotSupported(r.gvr.GroupResource(), req.Method))
+}
+
+// parse splits /api/{version}/... and /apis/{group}/{version}/... paths into the addressed resource.
+func (s *server) parse(path string) (request, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	var (
+		r  request
+		gv schema.GroupVersion
+	)
+	switch {
+	case len(parts) >= 3 && parts[0] == "api":
+		gv = schema.GroupVersion{Version: parts[1]}
+		parts = parts[2:]
+	case len(parts) >= 4 && parts[0] == "apis":
+		gv = schema.GroupVersion{Group: parts[1], Version: parts[2]}
+		parts = parts[3:]
+	default:
+		return r, apierrors.NewNotFound(schema.GroupResource{}, path)
+	}
+
+	// namespaces/{name}/status is a namespace subresource, namespaces/{namespace}/{resource} is a namespaced resource
+	if len(parts) >= 3 && parts[0] == "namespaces" && !(len(parts) == 3 && (parts[2] == "status" || parts[2] == "finalize")) {
+		r.namespace = parts[1]
+		parts = parts[2:]
+	}
+
+	r.gvr = gv.WithResource(parts[0])
+	if len(parts) > 1 {
+		r.name = parts[1]
+	}
+	if len(parts) > 2 {
+		r.subresource = parts[2]
+	}
+
+	gvk, err := s.mapper.KindFor(r.gvr)
+	if err != nil {
+		return r, apierrors.NewNotFound(r.gvr.GroupResource(), r.name)
+	}
+	r.gvk = gvk
+	return r, nil
+}
+
+func (s *server) get(req *http.Request, r request) (*http.Response, error) {
+	obj, err := s.store.get(r.gvr, r.namespace, r.name)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if metadataAs(req) == "PartialObjectMetadata" {
+		return jsonResponse(http.StatusOK, partialObjectMetadata(obj))
+	}
+	return jsonResponse(http.StatusOK, obj)
+}
+
+func (s *server) forbid(gr schema.GroupResource, forbidden bool) {
+	s.forbiddenLock.Lock()
+	defer s.forbiddenLock.Unlock()
+	if s.forbidden == nil {
+		s.forbidden = map[schema.GroupResource]bool{}
+	}
+	s.forbidden[gr] = forbidden
+}
+
+func (s *server) isForbidden(gr schema.GroupResource) bool {
+	s.forbiddenLock.RLock()
+	defer s.forbiddenLock.RUnlock()
+	return s.forbidden[gr]
+}
+
+func (s *server) list(req *http.Request, r request) (*http.Response, error) {
+	selector, fieldSelector, err := selectors(req)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if s.isForbidden(r.gvr.GroupResource()) {
+		return errorResponse(apierrors.NewForbidden(r.gvr.GroupResource(), "", fmt.Errorf("listing is forbidden")))
+	}
+
+	s.lists.Add(1)
+	objs, resourceVersion := s.store.list(r.gvr, r.namespace, selector, fieldSelector)
+	metadata := metadataAs(req) == "PartialObjectMetadataList"
+	items := make([]interface{}, 0, len(objs))
+	for _, obj := range objs {
+		if metadata {
+			obj = partialObjectMetadata(obj)
+		}
+		items = append(items, obj)
+	}
+
+	apiVersion, kind := r.gvk.GroupVersion().String(), r.gvk.Kind+"List"
+	if metadata {
+		apiVersion, kind = metav1.SchemeGroupVersion.String(), "PartialObjectMetadataList"
+	}
+	return jsonResponse(http.StatusOK, map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"resourceVersion": resourceVersion,
+		},
+		"items": items,
+	})
+}
+
+func (s *server) watch(req *http.Request, r request) (*http.Response, error) {
+	selector, fieldSelector, err := selectors(req)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	query := req.URL.Query()
+	sendInitialEvents := query.Get("sendInitialEvents") == "true"
+	if sendInitialEvents {
+		if s.disableWatchList {
+			return errorResponse(apierrors.NewBadRequest("resourceVersionMatch is forbidden for watch"))
+		}
+		if query.Get("resourceVersionMatch") != string(metav1.ResourceVersionMatchNotOlderThan) || query.Get("allowWatchBookmarks") != "true" {
+			return errorResponse(apierrors.NewBadRequest("sendInitialEvents requires resourceVersionMatch=NotOlderThan and allowWatchBookmarks"))
+		}
+		s.watchLists.Add(1)
+	}
+
+	w, err := s.store.watch(r.gvr, r.gvk, r.namespace, selector, fieldSelector, query.Get("resourceVersion"), sendInitialEvents)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	metadata := metadataAs(req) == "PartialObjectMetadata"
+	reader, writer := io.Pipe()
+	go func() {
+		<-req.Context().Done()
+		s.store.stopWatch(r.gvr, w)
+	}()
+	go func() {
+		defer writer.Close()
+		encoder := json.NewEncoder(writer)
+		for {
+			event, ok := w.next()
+			if !ok {
+				return
+			}
+			obj := event.obj
+			if metadata {
+				obj = partialObjectMetadata(obj)
+			}
+			if err := encoder.Encode(map[string]interface{}{
+				"type":   event.eventType,
+				"object": obj,
+			}); err != nil {
+				s.store.stopWatch(r.gvr, w)
+				return
+			}
+		}
+	}()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       reader,
+	}, nil
+}
+
+func (s *server) create(req *http.Request, r request) (*http.Response, error) {
+	obj, err := s.readObject(req, r)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	created, err := s.store.create(r.gvr, r.namespace, obj)
+	if err != nil {
+		return errorResponse(err)
+	}
+	return jsonResponse(http.StatusCreated, created)
+}
+
+func (s *server) update(req *http.Request, r request) (*http.Response, error) {
+	obj, err := s.readObject(req, r)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	updated, err := s.store.update(r.gvr, r.namespace, obj, r.subresource == "status")
+	if err != nil {
+		return errorResponse(err)
+	}
+	return jsonResponse(http.StatusOK, updated)
+}
+
+func (s *server) patch(req *http.Request, r request) (*http.Response, error) {
+	patch, err := io.ReadAll(req.Body)
+	if err != nil {
+		return errorResponse(apierrors.NewBadRequest(err.Error()))
+	}
+
+	existing, err := s.store.get(r.gvr, r.namespace, r.name)
+	if err != nil {
+		return errorResponse(err)
+	}
+	original, err := json.Marshal(existing)
+	if err != nil {
+		return errorResponse(apierrors.NewInternalError(err))
+	}
+
+	var patched []byte
+	switch types.PatchType(req.Header.Get("Content-Type")) {
+	case types.JSONPatchType:
+		var p jsonpatch.Patch
+		if p, err = jsonpatch.DecodePatch(patch); err == nil {
+			patched, err = p.Apply(original)
+		}
+	case types.MergePatchType:
+		patched, err = jsonpatch.MergePatch(original, patch)
+	case types.StrategicMergePatchType:
+		dataStruct, newErr := s.scheme.New(r.gvk)
+		if newErr != nil {
+			return errorResponse(unsupportedMediaType(string(types.StrategicMergePatchType)))
+		}
+		patched, err = strategicpatch.StrategicMergePatch(original, patch, dataStruct)
+	default:
+		return errorResponse(unsupportedMediaType(req.Header.Get("Content-Type")))
+	}
+	if err != nil {
+		return errorResponse(apierrors.NewBadRequest(err.Error()))
+	}
+
+	obj := map[string]interface{}{}
+	if err := utiljson.Unmarshal(patched, &obj); err != nil {
+		return errorResponse(apierrors.NewBadRequest(err.Error()))
+	}
+
+	updated, err := s.store.update(r.gvr, r.namespace, obj, r.subresource == "status")
+	if err != nil {
+		return errorResponse(err)
+	}
+	return jsonResponse(http.StatusOK, updated)
+}
+
+func (s *server) delete(r request) (*http.Response, error) {
+	deleted, err := s.store.delete(r.gvr, r.namespace, r.name)
+	if err != nil {
+		return errorResponse(err)
+	}
+	return jsonResponse(http.StatusOK, deleted)
+}
+
+func (s *server) deleteCollection(req *http.Request, r request) (*http.Response, error) {
+	selector, fieldSelector, err := selectors(req)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	objs, _ := s.store.list(r.gvr, r.namespace, selector, fieldSelector)
+	for _, obj := range objs {
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		namespace, _ := metadata["namespace"].(string)
+		name, _ := metadata["name"].(string)
+		if _, err := s.store.delete(r.gvr, namespace, name); err != nil && !apierrors.IsNotFound(err) {
+			return errorResponse(err)
+		}
+	}
+	return jsonResponse(http.StatusOK, &metav1.Status{Status: metav1.StatusSuccess})
+}
+
+// readObject decodes the request body and fills in the apiVersion and kind of the addressed resource, as
+// the apiserver would do for typed clients that leave them empty.
+func (s *server) readObject(req *http.Request, r request) (map[string]interface{}, error) {
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	obj := map[string]interface{}{}
+	if err := utiljson.Unmarshal(data, &obj); err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	obj["apiVersion"] = r.gvk.GroupVersion().String()
+	obj["kind"] = r.gvk.Kind
+
+	if r.name != "" {
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		if name, _ := metadata["name"].(string); name != r.name {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("the name of the object (%s) does not match the name on the URL (%s)", name, r.name))
+		}
+	}
+	return obj, nil
+}
+
+func unsupportedMediaType(contentType string) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusUnsupportedMediaType,
+		Reason:  metav1.StatusReasonUnsupportedMediaType,
+		Message: fmt.Sprintf("the body of the request was in an unknown format - accepted media types include: %s, %s, %s", types.JSONPatchType, types.MergePatchType, types.StrategicMergePatchType),
+		Details: &metav1.StatusDetails{Causes: []metav1.StatusCause{{Message: contentType}}},
+	}}
+}
+
+func selectors(req *http.Request) (labels.Selector, fields.Selector, error) {
+	query := req.URL.Query()
+	selector, err := labels.Parse(query.Get("labelSelector"))
+	if err != nil {
+		return nil, nil, apierrors.NewBadRequest(err.Error())
+	}
+	fieldSelector, err := fields.ParseSelector(query.Get("fieldSelector"))
+	if err != nil {
+		return nil, nil, apierrors.NewBadRequest(err.Error())
+	}
+	return selector, fieldSelector, nil
+}
+
+// metadataAs returns the metadata type a request asks for with its Accept header, PartialObjectMetadata or
+// PartialObjectMetadataList, or an empty string for complete objects. Only JSON is served.
+func metadataAs(req *http.Request) string {
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(accept)
+		if err != nil || mediaType != "application/json" {
+			continue
+		}
+		if params["g"] == metav1.GroupName && params["v"] == "v1" && params["as"] != "" {
+			return params["as"]
+		}
+		if params["as"] == "" {
+			return ""
+		}
+	}
+	return ""
+}
+
+func partialObjectMetadata(obj map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": metav1.SchemeGroupVersion.String(),
+		"kind":       "PartialObjectMetadata",
+		"metadata":   obj["metadata"],
+	}
+}
+
+func jsonResponse(code int, obj interface{}) (*http.Response, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(data)),
+	}, nil
+}
+
+func errorResponse(err error) (*http.Response, error) {
+	status := apierrors.NewInternalError(err).ErrStatus
+	if apiStatus, ok := err.(apierrors.APIStatus); ok {
+		status = apiStatus.Status()
+	}
+	status.APIVersion = "v1"
+	status.Kind = "Status"
+	return jsonResponse(int(status.Code), &status)
+}
@@ -0,0 +1,383 @@
+package fake
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+type objectKey struct {
+	namespace string
+	name      string
+}
+
+type storedEvent struct {
+	resourceVersion int64
+	eventType       watch.EventType
+	obj             map[string]interface{}
+}
+
+type resourceStore struct {
+	objects  map[objectKey]map[string]interface{}
+	events   []storedEvent
+	watchers map[*storeWatcher]bool
+}
+
+// store keeps objects as unstructured content and assigns resourceVersions from a single counter, the way
+// etcd does for the apiserver. Every change is recorded so that watches can resume from any resourceVersion
+// returned by a previous list.
+type store struct {
+	lock            sync.Mutex
+	resourceVersion int64
+	resources       map[schema.GroupVersionResource]*resourceStore
+}
+
+func newStore() *store {
+	return &store{
+		resources: map[schema.GroupVersionResource]*resourceStore{},
+	}
+}
+
+func (s *store) resource(gvr schema.GroupVersionResource) *resourceStore {
+	r, ok := s.resources[gvr]
+	if !ok {
+		r = &resourceStore{
+			objects:  map[objectKey]map[string]interface{}{},
+			watchers: map[*storeWatcher]bool{},
+		}
+		s.resources[gvr] = r
+	}
+	return r
+}
+
+func (s *store) nextResourceVersion(obj map[string]interface{}) int64 {
+	s.resourceVersion++
+	_ = unstructured.SetNestedField(obj, strconv.FormatInt(s.resourceVersion, 10), "metadata", "resourceVersion")
+	return s.resourceVersion
+}
+
+func (s *store) record(r *resourceStore, eventType watch.EventType, obj map[string]interface{}) {
+	event := storedEvent{
+		resourceVersion: s.resourceVersion,
+		eventType:       eventType,
+		obj:             runtime.DeepCopyJSON(obj),
+	}
+	r.events = append(r.events, event)
+	for w := range r.watchers {
+		w.send(event)
+	}
+}
+
+func (s *store) get(gvr schema.GroupVersionResource, namespace, name string) (map[string]interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	obj, ok := s.resource(gvr).objects[objectKey{namespace: namespace, name: name}]
+	if !ok {
+		return nil, apierrors.NewNotFound(gvr.GroupResource(), name)
+	}
+	return runtime.DeepCopyJSON(obj), nil
+}
+
+func (s *store) list(gvr schema.GroupVersionResource, namespace string, selector labels.Selector, fieldSelector fields.Selector) ([]map[string]interface{}, string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var result []map[string]interface{}
+	for key, obj := range s.resource(gvr).objects {
+		if namespace != "" && key.namespace != namespace {
+			continue
+		}
+		if !matches(obj, selector, fieldSelector) {
+			continue
+		}
+		result = append(result, runtime.DeepCopyJSON(obj))
+	}
+	return result, strconv.FormatInt(s.resourceVersion, 10)
+}
+
+func (s *store) create(gvr schema.GroupVersionResource, namespace string, obj map[string]interface{}) (map[string]interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	u := &unstructured.Unstructured{Object: obj}
+	if u.GetName() == "" {
+		if u.GetGenerateName() == "" {
+			return nil, apierrors.NewBadRequest("name or generateName is required")
+		}
+		u.SetName(u.GetGenerateName() + utilrand.String(5))
+	}
+	u.SetNamespace(namespace)
+
+	r := s.resource(gvr)
+	key := objectKey{namespace: namespace, name: u.GetName()}
+	if _, exists := r.objects[key]; exists {
+		return nil, apierrors.NewAlreadyExists(gvr.GroupResource(), u.GetName())
+	}
+
+	u.SetUID(uuid.NewUUID())
+	u.SetCreationTimestamp(metav1.NewTime(time.Now()))
+	u.SetGeneration(1)
+	u.SetDeletionTimestamp(nil)
+	s.nextResourceVersion(obj)
+
+	r.objects[key] = obj
+	s.record(r, watch.Added, obj)
+	return runtime.DeepCopyJSON(obj), nil
+}
+
+// update replaces the stored object. If status is true only the status of the stored object is replaced,
+// otherwise everything but the status is, mirroring resources that have a status subresource.
+func (s *store) update(gvr schema.GroupVersionResource, namespace string, obj map[string]interface{}, status bool) (map[string]interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	u := &unstructured.Unstructured{Object: obj}
+	r := s.resource(gvr)
+	key := objectKey{namespace: namespace, name: u.GetName()}
+	existing, ok := r.objects[key]
+	if !ok {
+		return nil, apierrors.NewNotFound(gvr.GroupResource(), u.GetName())
+	}
+
+	current := &unstructured.Unstructured{Object: existing}
+	if rv := u.GetResourceVersion(); rv != "" && rv != current.GetResourceVersion() {
+		return nil, apierrors.NewConflict(gvr.GroupResource(), u.GetName(),
+			fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+
+	var updated map[string]interface{}
+	if status {
+		updated = runtime.DeepCopyJSON(existing)
+		if newStatus, ok := obj["status"]; ok {
+			updated["status"] = newStatus
+		} else {
+			delete(updated, "status")
+		}
+	} else {
+		updated = obj
+		if oldStatus, ok := existing["status"]; ok {
+			updated["status"] = oldStatus
+		} else {
+			delete(updated, "status")
+		}
+	}
+
+	result := &unstructured.Unstructured{Object: updated}
+	if !status {
+		generation := current.GetGeneration()
+		if specChanged(existing, updated) {
+			generation++
+		}
+		result.SetGeneration(generation)
+	}
+	result.SetNamespace(namespace)
+	result.SetUID(current.GetUID())
+	result.SetCreationTimestamp(current.GetCreationTimestamp())
+	result.SetDeletionTimestamp(current.GetDeletionTimestamp())
+	s.nextResourceVersion(updated)
+
+	if result.GetDeletionTimestamp() != nil && len(result.GetFinalizers()) == 0 {
+		delete(r.objects, key)
+		s.record(r, watch.Deleted, updated)
+		return runtime.DeepCopyJSON(updated), nil
+	}
+
+	r.objects[key] = updated
+	s.record(r, watch.Modified, updated)
+	return runtime.DeepCopyJSON(updated), nil
+}
+
+// delete removes the object, or marks it for deletion if it still has finalizers.
+func (s *store) delete(gvr schema.GroupVersionResource, namespace, name string) (map[string]interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := s.resource(gvr)
+	key := objectKey{namespace: namespace, name: name}
+	existing, ok := r.objects[key]
+	if !ok {
+		return nil, apierrors.NewNotFound(gvr.GroupResource(), name)
+	}
+
+	u := &unstructured.Unstructured{Object: existing}
+	if len(u.GetFinalizers()) > 0 {
+		if u.GetDeletionTimestamp() == nil {
+			now := metav1.NewTime(time.Now())
+			u.SetDeletionTimestamp(&now)
+			s.nextResourceVersion(existing)
+			s.record(r, watch.Modified, existing)
+		}
+		return runtime.DeepCopyJSON(existing), nil
+	}
+
+	delete(r.objects, key)
+	s.nextResourceVersion(existing)
+	s.record(r, watch.Deleted, existing)
+	return runtime.DeepCopyJSON(existing), nil
+}
+
+// watch returns a watcher that first receives every event newer than resourceVersion. If resourceVersion
+// is empty or "0" the watcher starts with an ADDED event for every existing object. With sendInitialEvents, the
+// watcher starts with an ADDED event for every existing object followed by the bookmark that ends the initial
+// events, like a streaming list.
+func (s *store) watch(gvr schema.GroupVersionResource, gvk schema.GroupVersionKind, namespace string, selector labels.Selector, fieldSelector fields.Selector, resourceVersion string, sendInitialEvents bool) (*storeWatcher, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := s.resource(gvr)
+	w := newStoreWatcher(namespace, selector, fieldSelector)
+
+	switch {
+	case sendInitialEvents:
+		for _, obj := range r.objects {
+			w.send(storedEvent{eventType: watch.Added, obj: runtime.DeepCopyJSON(obj)})
+		}
+		apiVersion, kind := gvk.ToAPIVersionAndKind()
+		w.push(storedEvent{eventType: watch.Bookmark, obj: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"resourceVersion": strconv.FormatInt(s.resourceVersion, 10),
+				"annotations": map[string]interface{}{
+					metav1.InitialEventsAnnotationKey: "true",
+				},
+			},
+		}})
+	case resourceVersion == "" || resourceVersion == "0":
+		for _, obj := range r.objects {
+			w.send(storedEvent{eventType: watch.Added, obj: runtime.DeepCopyJSON(obj)})
+		}
+	default:
+		rv, err := strconv.ParseInt(resourceVersion, 10, 64)
+		if err != nil {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid resourceVersion %q", resourceVersion))
+		}
+		for _, event := range r.events {
+			if event.resourceVersion > rv {
+				w.send(event)
+			}
+		}
+	}
+
+	r.watchers[w] = true
+	return w, nil
+}
+
+func (s *store) watches(gvr schema.GroupVersionResource) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.resource(gvr).watchers)
+}
+
+func (s *store) stopWatch(gvr schema.GroupVersionResource, w *storeWatcher) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.resource(gvr).watchers, w)
+	w.stop()
+}
+
+// storeWatcher buffers events without bounds so that writing to the store never blocks on a slow reader.
+type storeWatcher struct {
+	namespace     string
+	selector      labels.Selector
+	fieldSelector fields.Selector
+
+	lock    sync.Mutex
+	cond    *sync.Cond
+	pending []storedEvent
+	stopped bool
+}
+
+func newStoreWatcher(namespace string, selector labels.Selector, fieldSelector fields.Selector) *storeWatcher {
+	w := &storeWatcher{
+		namespace:     namespace,
+		selector:      selector,
+		fieldSelector: fieldSelector,
+	}
+	w.cond = sync.NewCond(&w.lock)
+	return w
+}
+
+func (w *storeWatcher) send(event storedEvent) {
+	u := &unstructured.Unstructured{Object: event.obj}
+	if w.namespace != "" && u.GetNamespace() != w.namespace {
+		return
+	}
+	if !matches(event.obj, w.selector, w.fieldSelector) {
+		return
+	}
+	w.push(event)
+}
+
+// push queues the event without filtering it.
+func (w *storeWatcher) push(event storedEvent) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.pending = append(w.pending, event)
+	w.cond.Signal()
+}
+
+// next blocks until an event is available, it returns false once the watcher is stopped.
+func (w *storeWatcher) next() (storedEvent, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for len(w.pending) == 0 && !w.stopped {
+		w.cond.Wait()
+	}
+	if w.stopped {
+		return storedEvent{}, false
+	}
+	event := w.pending[0]
+	w.pending = w.pending[1:]
+	return event, true
+}
+
+func (w *storeWatcher) stop() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.stopped = true
+	w.cond.Broadcast()
+}
+
+func matches(obj map[string]interface{}, selector labels.Selector, fieldSelector fields.Selector) bool {
+	u := &unstructured.Unstructured{Object: obj}
+	if selector != nil && !selector.Matches(labels.Set(u.GetLabels())) {
+		return false
+	}
+	if fieldSelector != nil && !fieldSelector.Matches(fields.Set{
+		"metadata.name":      u.GetName(),
+		"metadata.namespace": u.GetNamespace(),
+	}) {
+		return false
+	}
+	return true
+}
+
+// specChanged reports whether anything besides metadata and status differs between the two objects.
+func specChanged(old, new map[string]interface{}) bool {
+	strip := func(obj map[string]interface{}) map[string]interface{} {
+		result := map[string]interface{}{}
+		for k, v := range obj {
+			if k == "metadata" || k == "status" {
+				continue
+			}
+			result[k] = v
+		}
+		return result
+	}
+	return !reflect.DeepEqual(strip(old), strip(new))
+}
@@ -0,0 +1,103 @@
+/*
+Package health serves named health checks over HTTP in the format of the Kubernetes apiserver's healthz, livez and
+readyz endpoints. Every check is reported on its own line with ?verbose, failed checks are always listed, and
+checks can be skipped with ?exclude=<name>.
+*/
+package health
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Check is a single named health check.
+type Check interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type namedCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// NamedCheck returns a Check with the given name that runs check.
+func NamedCheck(name string, check func(ctx context.Context) error) Check {
+	return &namedCheck{
+		name:  name,
+		check: check,
+	}
+}
+
+func (n *namedCheck) Name() string {
+	return n.name
+}
+
+func (n *namedCheck) Check(ctx context.Context) error {
+	return n.check(ctx)
+}
+
+// NewHandler returns an http.Handler that runs the checks returned by checks on every request. name is used in
+// the summary line, for example "readyz check passed". The checks are looked up per request, so that checks for
+// caches and controllers created at runtime are included.
+func NewHandler(name string, checks func() []Check) http.Handler {
+	return &handler{
+		name:   name,
+		checks: checks,
+	}
+}
+
+type handler struct {
+	name   string
+	checks func() []Check
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	excluded := map[string]bool{}
+	for _, name := range query["exclude"] {
+		excluded[name] = true
+	}
+
+	checks := h.checks()
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].Name() < checks[j].Name()
+	})
+
+	var (
+		output bytes.Buffer
+		failed bool
+	)
+	for _, check := range checks {
+		if excluded[check.Name()] {
+			fmt.Fprintf(&output, "[+]%s excluded: ok\n", check.Name())
+			delete(excluded, check.Name())
+			continue
+		}
+		if err := check.Check(req.Context()); err != nil {
+			fmt.Fprintf(&output, "[-]%s failed: %v\n", check.Name(), err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(&output, "[+]%s ok\n", check.Name())
+	}
+	for name := range excluded {
+		fmt.Fprintf(&output, "warn: some health checks cannot be excluded: no matches for %q\n", name)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if failed {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "%s%s check failed\n", output.String(), h.name)
+		return
+	}
+	if _, verbose := query["verbose"]; verbose {
+		fmt.Fprintf(w, "%s%s check passed\n", output.String(), h.name)
+		return
+	}
+	fmt.Fprint(w, "ok")
+}
@@ -0,0 +1,45 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	failing := true
+	handler := NewHandler("readyz", func() []Check {
+		return []Check{
+			NamedCheck("b", func(context.Context) error { return nil }),
+			NamedCheck("a", func(context.Context) error {
+				if failing {
+					return errors.New("not synced")
+				}
+				return nil
+			}),
+		}
+	})
+
+	get := func(url string) (int, string) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	code, body := get("/readyz")
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Equal(t, "[-]a failed: not synced\n[+]b ok\nreadyz check failed\n", body)
+
+	code, body = get("/readyz?exclude=a&exclude=c")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body)
+
+	failing = false
+	code, body = get("/readyz?verbose")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "[+]a ok\n[+]b ok\nreadyz check passed\n", body)
+}
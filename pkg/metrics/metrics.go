@@ -3,23 +3,38 @@ package metrics
 import (
 	"context"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
-var prometheusMetrics = false
+var (
+	prometheusMetrics = false
+
+	// histogramLock guards the histograms that SetHistogramBuckets replaces
+	histogramLock sync.RWMutex
+)
 
 const (
 	lassoSubsystem      = "lasso_controller"
 	controllerNameLabel = "controller_name"
 	handlerNameLabel    = "handler_name"
 	hasErrorLabel       = "has_error"
+	namespaceLabel      = "namespace"
 
 	contextLabel = "ctx"
 	groupLabel   = "group"
 	versionLabel = "version"
 	kindLabel    = "kind"
+	verbLabel    = "verb"
+	limiterLabel = "limiter"
+	reasonLabel  = "reason"
+	resultLabel  = "result"
+	stateLabel   = "state"
+	driftLabel   = "drift"
+	expiredLabel = "expired"
 )
 
 type contextIDKey struct{}
@@ -56,14 +71,178 @@ var (
 		[]string{contextLabel, groupLabel, versionLabel, kindLabel},
 	)
 
+	// cachedBytes estimates the size of the cached objects per GroupVersionKind from the serialized size of a
+	// sample of them.
+	cachedBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "cached_object_bytes",
+		Help:      "Approximate size of the cached objects in bytes",
+	}, []string{contextLabel, groupLabel, versionLabel, kindLabel})
+
 	// reconcileTime is a prometheus histogram metric exposes the duration of reconciliations per controller.
 	// controller label refers to the controller name
-	reconcileTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	reconcileTime = newReconcileTime(prometheus.DefBuckets)
+
+	// namespaceQueueDepth exposes the depth of the per-namespace sub-queues of controllers using namespace
+	// fairness. The number of namespace label values is bounded by the controller.
+	namespaceQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "namespace_queue_depth",
+		Help:      "Current depth of the per-namespace workqueues of controllers with namespace fairness enabled",
+	}, []string{controllerNameLabel, namespaceLabel})
+	// clientThrottleTime exposes how long requests waited for the client-side request budgets of a
+	// SharedClientFactory. limiter is one of global, kind or verb.
+	clientThrottleTime = newClientThrottleTime(defaultClientThrottleBuckets)
+	// queueWaitTime exposes how long keys waited in the workqueue of a controller, from the time they were
+	// ready until a worker picked them up.
+	queueWaitTime = newQueueWaitTime(defaultQueueWaitBuckets)
+	// handlerErrors counts handler errors by reason, one of conflict, not_found, forbidden or other.
+	handlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "total_handler_errors",
+		Help:      "Total count of handler errors by reason",
+	}, []string{controllerNameLabel, handlerNameLabel, reasonLabel})
+	// lastSuccessfulReconcile exposes the unix time of the last key a controller handled without error.
+	lastSuccessfulReconcile = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "last_successful_reconcile_timestamp_seconds",
+		Help:      "Unix time of the last successful reconciliation per controller",
+	}, []string{controllerNameLabel})
+	// rateLimitedKeys exposes the number of keys of a controller that are in rate-limited backoff, that is keys
+	// that failed or were enqueued with a rate limit and were not handled successfully since.
+	rateLimitedKeys = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "rate_limited_keys",
+		Help:      "Current number of keys in rate-limited backoff per controller",
+	}, []string{controllerNameLabel})
+	// controllerConstructionFailing is 1 while a shared controller could not be constructed, for example because
+	// the CRD of its type is missing, and 0 once it was constructed.
+	controllerConstructionFailing = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "controller_construction_failing",
+		Help:      "Whether the construction of a shared controller is failing",
+	}, []string{controllerNameLabel})
+	// oldestQueuedKey exposes the age of the oldest key waiting in the workqueue of each controller, it is
+	// computed when the metrics are collected.
+	oldestQueuedKey = newQueueAgeCollector()
+	// cacheTransformSavedBytes estimates how many bytes the transforms of the caches removed from the objects
+	// before storing them.
+	cacheTransformSavedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "cache_transform_saved_bytes_total",
+		Help:      "Estimated bytes removed from cached objects by cache transforms",
+	}, []string{groupLabel, versionLabel, kindLabel})
+	// cacheSnapshotLoads counts the snapshots caches tried to start from. result is hit if a snapshot was loaded,
+	// miss if there was none and expired if a loaded snapshot was too old to resume watching from it, expired loads
+	// are counted as hit as well.
+	cacheSnapshotLoads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "cache_snapshot_loads_total",
+		Help:      "Total count of cache snapshot loads by result",
+	}, []string{contextLabel, groupLabel, versionLabel, kindLabel, resultLabel})
+	// cacheSnapshotAge exposes the age of the snapshot a cache was started from.
+	cacheSnapshotAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "cache_snapshot_age_seconds",
+		Help:      "Age of the snapshot a cache was started from at the time it was loaded",
+	}, []string{contextLabel, groupLabel, versionLabel, kindLabel})
+	// apiserverHealthTransitions counts the changes of the apiserver health seen by the shared cache factories,
+	// state is the new health.
+	apiserverHealthTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "apiserver_health_transitions_total",
+		Help:      "Total count of apiserver health transitions by new state",
+	}, []string{contextLabel, stateLabel})
+	// cacheDrift exposes the objects the last drift audit of a cache found to be missing from the cache, extra in
+	// the cache or stale.
+	cacheDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "cache_drift_objects",
+		Help:      "Number of drifted objects found by the last cache audit by kind of drift",
+	}, []string{contextLabel, groupLabel, versionLabel, kindLabel, driftLabel})
+	// cacheInformers counts the running caches of the shared cache factories by state, active caches are in use
+	// and idle caches wait to be stopped after their last reference was released.
+	cacheInformers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "cache_informers",
+		Help:      "Number of running caches by state",
+	}, []string{contextLabel, stateLabel})
+	// cacheLists counts the lists of the caches by result, lists after the initial one are relists.
+	cacheLists = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "cache_lists_total",
+		Help:      "Total count of cache lists by result",
+	}, []string{groupLabel, versionLabel, kindLabel, resultLabel})
+	// cacheWatchRestarts counts the watches of the caches that were restarted without listing.
+	cacheWatchRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "cache_watch_restarts_total",
+		Help:      "Total count of cache watches restarted without listing",
+	}, []string{groupLabel, versionLabel, kindLabel})
+	// cacheWatchErrors counts the errors that ended the lists and watches of the caches, expired is true for
+	// resourceVersions that expired, after which the caches list again.
+	cacheWatchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "cache_watch_errors_total",
+		Help:      "Total count of errors ending cache lists and watches",
+	}, []string{groupLabel, versionLabel, kindLabel, expiredLabel})
+)
+
+var (
+	defaultClientThrottleBuckets = []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	defaultQueueWaitBuckets      = []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 600}
+)
+
+// HistogramBuckets overrides the buckets of lasso's histograms. Nil fields keep the default buckets.
+type HistogramBuckets struct {
+	ReconcileTime  []float64
+	QueueWait      []float64
+	ClientThrottle []float64
+}
+
+// SetHistogramBuckets replaces the buckets of lasso's histograms. It must be called before the metrics are
+// registered, which rules out metrics registered through the CATTLE_PROMETHEUS_METRICS environment variable.
+func SetHistogramBuckets(buckets HistogramBuckets) {
+	histogramLock.Lock()
+	defer histogramLock.Unlock()
+
+	if buckets.ReconcileTime != nil {
+		reconcileTime = newReconcileTime(buckets.ReconcileTime)
+	}
+	if buckets.QueueWait != nil {
+		queueWaitTime = newQueueWaitTime(buckets.QueueWait)
+	}
+	if buckets.ClientThrottle != nil {
+		clientThrottleTime = newClientThrottleTime(buckets.ClientThrottle)
+	}
+}
+
+func newReconcileTime(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Subsystem: lassoSubsystem,
 		Name:      "reconcile_time_seconds",
 		Help:      "Histogram of the durations per reconciliation per controller",
+		Buckets:   buckets,
 	}, []string{controllerNameLabel, handlerNameLabel, hasErrorLabel})
-)
+}
+
+func newClientThrottleTime(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "client_throttle_seconds",
+		Help:      "Histogram of the time requests waited for client-side request budgets",
+		Buckets:   buckets,
+	}, []string{groupLabel, versionLabel, kindLabel, verbLabel, limiterLabel})
+}
+
+func newQueueWaitTime(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: lassoSubsystem,
+		Name:      "queue_wait_seconds",
+		Help:      "Histogram of the time keys waited in the workqueue before their handler started per controller",
+		Buckets:   buckets,
+	}, []string{controllerNameLabel})
+}
 
 func IncTotalHandlerExecutions(controllerName, handlerName string, hasError bool) {
 	if prometheusMetrics {
@@ -105,8 +284,38 @@ func DelTotalCachedObjects(ctxID string, gvk schema.GroupVersionKind) {
 	}
 }
 
+// SetCachedBytes sets the approximate size of the cached objects for the specified context and GroupVersionKind
+func SetCachedBytes(ctxID string, gvk schema.GroupVersionKind, bytes int64) {
+	if prometheusMetrics {
+		cachedBytes.With(
+			prometheus.Labels{
+				contextLabel: ctxID,
+				groupLabel:   gvk.Group,
+				versionLabel: gvk.Version,
+				kindLabel:    gvk.Kind,
+			},
+		).Set(float64(bytes))
+	}
+}
+
+// DelCachedBytes deletes the cached objects size metric matching the provided context and GroupVersionKind
+func DelCachedBytes(ctxID string, gvk schema.GroupVersionKind) {
+	if prometheusMetrics {
+		cachedBytes.Delete(
+			prometheus.Labels{
+				contextLabel: ctxID,
+				groupLabel:   gvk.Group,
+				versionLabel: gvk.Version,
+				kindLabel:    gvk.Kind,
+			},
+		)
+	}
+}
+
 func ReportReconcileTime(controllerName, handlerName string, hasError bool, observeTime float64) {
 	if prometheusMetrics {
+		histogramLock.RLock()
+		defer histogramLock.RUnlock()
 		reconcileTime.With(
 			prometheus.Labels{
 				controllerNameLabel: controllerName,
@@ -116,3 +325,273 @@ func ReportReconcileTime(controllerName, handlerName string, hasError bool, obse
 		).Observe(observeTime)
 	}
 }
+
+// SetNamespaceQueueDepth sets the depth of the namespace sub-queue of the given controller
+func SetNamespaceQueueDepth(controllerName, namespace string, depth int) {
+	if prometheusMetrics {
+		namespaceQueueDepth.With(
+			prometheus.Labels{
+				controllerNameLabel: controllerName,
+				namespaceLabel:      namespace,
+			},
+		).Set(float64(depth))
+	}
+}
+
+// DelNamespaceQueueDepth deletes the depth metric of the namespace sub-queue of the given controller
+func DelNamespaceQueueDepth(controllerName, namespace string) {
+	if prometheusMetrics {
+		namespaceQueueDepth.Delete(
+			prometheus.Labels{
+				controllerNameLabel: controllerName,
+				namespaceLabel:      namespace,
+			},
+		)
+	}
+}
+
+// AddCacheTransformSavedBytes adds the estimated bytes a cache transform removed from an object of the GroupVersionKind
+func AddCacheTransformSavedBytes(gvk schema.GroupVersionKind, bytes int) {
+	if prometheusMetrics {
+		cacheTransformSavedBytes.With(
+			prometheus.Labels{
+				groupLabel:   gvk.Group,
+				versionLabel: gvk.Version,
+				kindLabel:    gvk.Kind,
+			},
+		).Add(float64(bytes))
+	}
+}
+
+// IncCacheLists counts a list of the cache of the GroupVersionKind
+func IncCacheLists(gvk schema.GroupVersionKind, success bool) {
+	if prometheusMetrics {
+		result := "error"
+		if success {
+			result = "success"
+		}
+		cacheLists.With(
+			prometheus.Labels{
+				groupLabel:   gvk.Group,
+				versionLabel: gvk.Version,
+				kindLabel:    gvk.Kind,
+				resultLabel:  result,
+			},
+		).Inc()
+	}
+}
+
+// IncCacheWatchRestarts counts a watch of the cache of the GroupVersionKind restarted without listing
+func IncCacheWatchRestarts(gvk schema.GroupVersionKind) {
+	if prometheusMetrics {
+		cacheWatchRestarts.With(
+			prometheus.Labels{
+				groupLabel:   gvk.Group,
+				versionLabel: gvk.Version,
+				kindLabel:    gvk.Kind,
+			},
+		).Inc()
+	}
+}
+
+// IncCacheWatchErrors counts an error ending a list or watch of the cache of the GroupVersionKind
+func IncCacheWatchErrors(gvk schema.GroupVersionKind, expired bool) {
+	if prometheusMetrics {
+		cacheWatchErrors.With(
+			prometheus.Labels{
+				groupLabel:   gvk.Group,
+				versionLabel: gvk.Version,
+				kindLabel:    gvk.Kind,
+				expiredLabel: strconv.FormatBool(expired),
+			},
+		).Inc()
+	}
+}
+
+// IncCacheSnapshotLoads counts a snapshot load of the cache of the GroupVersionKind with the given result
+func IncCacheSnapshotLoads(ctxID string, gvk schema.GroupVersionKind, result string) {
+	if prometheusMetrics {
+		cacheSnapshotLoads.With(
+			prometheus.Labels{
+				contextLabel: ctxID,
+				groupLabel:   gvk.Group,
+				versionLabel: gvk.Version,
+				kindLabel:    gvk.Kind,
+				resultLabel:  result,
+			},
+		).Inc()
+	}
+}
+
+// SetCacheSnapshotAge sets the age of the snapshot the cache of the GroupVersionKind was started from
+func SetCacheSnapshotAge(ctxID string, gvk schema.GroupVersionKind, age float64) {
+	if prometheusMetrics {
+		cacheSnapshotAge.With(
+			prometheus.Labels{
+				contextLabel: ctxID,
+				groupLabel:   gvk.Group,
+				versionLabel: gvk.Version,
+				kindLabel:    gvk.Kind,
+			},
+		).Set(age)
+	}
+}
+
+// IncAPIServerHealthTransitions counts a change of the apiserver health to healthy or unhealthy
+func IncAPIServerHealthTransitions(ctxID string, healthy bool) {
+	if prometheusMetrics {
+		state := "unhealthy"
+		if healthy {
+			state = "healthy"
+		}
+		apiserverHealthTransitions.With(
+			prometheus.Labels{
+				contextLabel: ctxID,
+				stateLabel:   state,
+			},
+		).Inc()
+	}
+}
+
+// SetCacheDrift sets the number of objects of the GroupVersionKind with the given drift found by the last audit
+func SetCacheDrift(ctxID string, gvk schema.GroupVersionKind, drift string, count int) {
+	if prometheusMetrics {
+		cacheDrift.With(
+			prometheus.Labels{
+				contextLabel: ctxID,
+				groupLabel:   gvk.Group,
+				versionLabel: gvk.Version,
+				kindLabel:    gvk.Kind,
+				driftLabel:   drift,
+			},
+		).Set(float64(count))
+	}
+}
+
+// DelCacheDrift deletes the drift metrics of the GroupVersionKind
+func DelCacheDrift(ctxID string, gvk schema.GroupVersionKind) {
+	if prometheusMetrics {
+		cacheDrift.DeletePartialMatch(
+			prometheus.Labels{
+				contextLabel: ctxID,
+				groupLabel:   gvk.Group,
+				versionLabel: gvk.Version,
+				kindLabel:    gvk.Kind,
+			},
+		)
+	}
+}
+
+// SetCacheInformers sets the number of running caches in the given state for the specified context
+func SetCacheInformers(ctxID, state string, count int) {
+	if prometheusMetrics {
+		cacheInformers.With(
+			prometheus.Labels{
+				contextLabel: ctxID,
+				stateLabel:   state,
+			},
+		).Set(float64(count))
+	}
+}
+
+// DelCacheInformers deletes the running caches metric of the specified context
+func DelCacheInformers(ctxID string) {
+	if prometheusMetrics {
+		cacheInformers.DeletePartialMatch(
+			prometheus.Labels{
+				contextLabel: ctxID,
+			},
+		)
+	}
+}
+
+// ReportClientThrottleTime records how long a request for the GroupVersionKind waited for the given limiter
+func ReportClientThrottleTime(gvk schema.GroupVersionKind, verb, limiter string, observeTime float64) {
+	if prometheusMetrics {
+		histogramLock.RLock()
+		defer histogramLock.RUnlock()
+		clientThrottleTime.With(
+			prometheus.Labels{
+				groupLabel:   gvk.Group,
+				versionLabel: gvk.Version,
+				kindLabel:    gvk.Kind,
+				verbLabel:    verb,
+				limiterLabel: limiter,
+			},
+		).Observe(observeTime)
+	}
+}
+
+// ReportQueueWaitTime records how long a key waited in the workqueue of the given controller
+func ReportQueueWaitTime(controllerName string, observeTime float64) {
+	if prometheusMetrics {
+		histogramLock.RLock()
+		defer histogramLock.RUnlock()
+		queueWaitTime.With(
+			prometheus.Labels{
+				controllerNameLabel: controllerName,
+			},
+		).Observe(observeTime)
+	}
+}
+
+// IncHandlerErrors increments the count of handler errors with the given reason
+func IncHandlerErrors(controllerName, handlerName, reason string) {
+	if prometheusMetrics {
+		handlerErrors.With(
+			prometheus.Labels{
+				controllerNameLabel: controllerName,
+				handlerNameLabel:    handlerName,
+				reasonLabel:         reason,
+			},
+		).Inc()
+	}
+}
+
+// SetLastSuccessfulReconcile sets the time of the last successful reconciliation of the given controller
+func SetLastSuccessfulReconcile(controllerName string, t time.Time) {
+	if prometheusMetrics {
+		lastSuccessfulReconcile.With(
+			prometheus.Labels{
+				controllerNameLabel: controllerName,
+			},
+		).Set(float64(t.UnixNano()) / float64(time.Second))
+	}
+}
+
+// SetRateLimitedKeys sets the number of keys in rate-limited backoff of the given controller
+func SetRateLimitedKeys(controllerName string, count int) {
+	if prometheusMetrics {
+		rateLimitedKeys.With(
+			prometheus.Labels{
+				controllerNameLabel: controllerName,
+			},
+		).Set(float64(count))
+	}
+}
+
+// RegisterOldestQueuedKey registers a function returning the age of the oldest key in the workqueue of the given
+// controller, replacing the function previously registered for the controller.
+func RegisterOldestQueuedKey(controllerName string, age func() time.Duration) {
+	oldestQueuedKey.set(controllerName, age)
+}
+
+// UnregisterOldestQueuedKey removes the function registered for the given controller
+func UnregisterOldestQueuedKey(controllerName string) {
+	oldestQueuedKey.set(controllerName, nil)
+}
+
+// SetControllerConstructionFailing sets whether the construction of the given controller is failing
+func SetControllerConstructionFailing(controllerName string, failing bool) {
+	if prometheusMetrics {
+		value := 0.
+		if failing {
+			value = 1
+		}
+		controllerConstructionFailing.With(
+			prometheus.Labels{
+				controllerNameLabel: controllerName,
+			},
+		).Set(value)
+	}
+}
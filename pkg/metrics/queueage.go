@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// queueAgeCollector reports the age of the oldest queued key of every controller. The age grows while a queue
+// is stuck without any adds or gets, so it is computed on collection instead of being set on queue events.
+type queueAgeCollector struct {
+	desc *prometheus.Desc
+
+	lock sync.RWMutex
+	ages map[string]func() time.Duration
+}
+
+func newQueueAgeCollector() *queueAgeCollector {
+	return &queueAgeCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName("", lassoSubsystem, "oldest_queued_key_seconds"),
+			"Age of the oldest key waiting in the workqueue per controller",
+			[]string{controllerNameLabel}, nil,
+		),
+		ages: map[string]func() time.Duration{},
+	}
+}
+
+func (q *queueAgeCollector) set(controllerName string, age func() time.Duration) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if age == nil {
+		delete(q.ages, controllerName)
+		return
+	}
+	q.ages[controllerName] = age
+}
+
+func (q *queueAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- q.desc
+}
+
+func (q *queueAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	for name, age := range q.ages {
+		ch <- prometheus.MustNewConstMetric(q.desc, prometheus.GaugeValue, age().Seconds(), name)
+	}
+}
@@ -24,10 +24,30 @@ func Enabled() bool {
 // workqueue metrics, with the provided registerer
 func MustRegisterWithWorkqueue(registerer prometheus.Registerer) {
 	prometheusMetrics = true
+	histogramLock.RLock()
+	defer histogramLock.RUnlock()
 	registerer.MustRegister(
 		TotalControllerExecutions,
 		TotalCachedObjects,
+		cachedBytes,
 		reconcileTime,
+		namespaceQueueDepth,
+		clientThrottleTime,
+		queueWaitTime,
+		handlerErrors,
+		lastSuccessfulReconcile,
+		rateLimitedKeys,
+		oldestQueuedKey,
+		controllerConstructionFailing,
+		cacheTransformSavedBytes,
+		cacheSnapshotLoads,
+		cacheSnapshotAge,
+		cacheInformers,
+		apiserverHealthTransitions,
+		cacheDrift,
+		cacheLists,
+		cacheWatchRestarts,
+		cacheWatchErrors,
 		// expose workqueue metrics
 		depth,
 		adds,
@@ -46,9 +66,29 @@ func MustRegisterWithWorkqueue(registerer prometheus.Registerer) {
 // when both packages register metrics with the same name.
 func MustRegister(registerer prometheus.Registerer) {
 	prometheusMetrics = true
+	histogramLock.RLock()
+	defer histogramLock.RUnlock()
 	registerer.MustRegister(
 		TotalControllerExecutions,
 		TotalCachedObjects,
+		cachedBytes,
 		reconcileTime,
+		namespaceQueueDepth,
+		clientThrottleTime,
+		queueWaitTime,
+		handlerErrors,
+		lastSuccessfulReconcile,
+		rateLimitedKeys,
+		oldestQueuedKey,
+		controllerConstructionFailing,
+		cacheTransformSavedBytes,
+		cacheSnapshotLoads,
+		cacheSnapshotAge,
+		cacheInformers,
+		apiserverHealthTransitions,
+		cacheDrift,
+		cacheLists,
+		cacheWatchRestarts,
+		cacheWatchErrors,
 	)
 }